@@ -0,0 +1,132 @@
+package bot
+
+import (
+	"bitbot/pb"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/charmbracelet/log"
+)
+
+// Access requests: when a non-admin asks for an admin-only tool, call_tool
+// queues the call as a pending action of kind "access" instead of refusing it.
+// The Approve/Deny prompt goes to ACCESS_REQUEST_CHANNEL_ID if set, else to the
+// admin's DMs (falling back to the original channel). On approval the tool runs
+// with the requester's arguments, and the outcome is posted back in the
+// channel the request came from.
+
+// maxAccessRequestsPerUser bounds how many access requests one user may have
+// outstanding, so a chatty conversation cannot flood the admins.
+const maxAccessRequestsPerUser = 3
+
+// requestableTools returns the admins-visibility tools the caller cannot use
+// but may ask for. Tools denied to the caller by policy and other users'
+// private tools cannot be requested.
+func requestableTools(c toolCaller) []*registeredTool {
+	policies, err := toolPolicies()
+	if err != nil {
+		return nil
+	}
+	toolRegistryMu.RLock()
+	defer toolRegistryMu.RUnlock()
+	var out []*registeredTool
+	for _, t := range toolRegistry {
+		if t.Visibility != pb.MCPVisibilityAdmins || (t.Owner != "" && t.Owner == c.userID) {
+			continue
+		}
+		if allowed, denied := policyDecision(policies, t, c); !denied && !allowed && !c.isAdmin {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// accessRequestChannel returns the channel admins review access requests in,
+// or "" to send them to the admin's DMs.
+func accessRequestChannel() string {
+	return strings.TrimSpace(os.Getenv("ACCESS_REQUEST_CHANNEL_ID"))
+}
+
+// adminPromptChannel picks where to post an access request prompt.
+func adminPromptChannel(s *discordgo.Session, channelID string) string {
+	if ch := accessRequestChannel(); ch != "" {
+		return ch
+	}
+	dm, err := s.UserChannelCreate(AllowedUserID)
+	if err != nil {
+		// ADMIN_DISCORD_ID may be a role rather than a user.
+		log.Warnf("Failed to open admin DM for access request: %v", err)
+		return channelID
+	}
+	return dm.ID
+}
+
+// handleAccessRequest queues a call of t by a caller who lacks access and
+// returns the call_tool result for the model.
+func handleAccessRequest(s *discordgo.Session, t *registeredTool, args map[string]any, userID, channelID, guildID string) string {
+	open, err := pb.ListPendingActions(userID)
+	if err != nil {
+		log.Errorf("Failed to list pending actions for %s: %v", userID, err)
+		return jsonResult("error", "failed to queue the access request")
+	}
+	count := 0
+	for _, p := range open {
+		if p.Kind != pb.PendingKindAccess {
+			continue
+		}
+		if p.Tool == t.Name && p.Source == t.Source {
+			return jsonResult("pending", fmt.Sprintf("an access request for %q is already waiting for an admin. The tool has NOT run — do not retry; tell the user to wait.", t.Name))
+		}
+		count++
+	}
+	if count >= maxAccessRequestsPerUser {
+		return jsonResult("error", fmt.Sprintf("%q is admin-only, and the user already has %d access requests waiting for an admin", t.Name, count))
+	}
+
+	rule, err := approvalRuleFor(t)
+	if err != nil {
+		return jsonResult("error", err.Error())
+	}
+	p := newPendingAction(t, args, userID, channelID, guildID, rule)
+	p.Kind = pb.PendingKindAccess
+	p.PromptChannelID = adminPromptChannel(s, channelID)
+	header := fmt.Sprintf("🙋 **Access request:** <@%s> asked to run admin-only `%s` in <#%s>.", userID, t.Name, channelID)
+	if err := postPendingAction(s, p, header); err != nil {
+		log.Errorf("failed to send access request for %s: %v", t.Name, err)
+		return jsonResult("error", "failed to send the access request to the admins")
+	}
+	return jsonResult("pending", fmt.Sprintf("%q is admin-only, so an access request with these arguments was sent to the admins. If one approves it, the tool runs and the result is posted in this channel. The tool has NOT run yet — do not retry; tell the user their request is waiting for an admin.", t.Name))
+}
+
+// notifyRequester posts the outcome of an access request in the channel it
+// came from, with any files the tool returned. A result too long for a message
+// is attached as a file.
+func notifyRequester(s *discordgo.Session, p *pb.PendingAction, content, result string, files ...*discordgo.File) {
+	msg := &discordgo.MessageSend{
+		Content:         content,
+		AllowedMentions: &discordgo.MessageAllowedMentions{Users: []string{p.UserID}},
+		Files:           files,
+	}
+	if result != "" {
+		msg.Content += "\n" + result
+		if utf8.RuneCountInString(msg.Content) > discordMessageLimit {
+			msg.Content = truncateToLimit(msg.Content, discordMessageLimit-40) + "\n… (full result attached)"
+			msg.Files = append(msg.Files, textAttachment(p.Tool, result))
+		}
+	}
+	if _, err := s.ChannelMessageSendComplex(p.ChannelID, msg); err != nil {
+		log.Warnf("Failed to post access request outcome for %s: %v", p.ID, err)
+	}
+}
+
+// pendingPromptLink returns a jump link to p's prompt message.
+func pendingPromptLink(p *pb.PendingAction) string {
+	guildID := p.GuildID
+	if p.PromptChannelID != "" && p.PromptChannelID != p.ChannelID && p.PromptChannelID != accessRequestChannel() {
+		guildID = "" // the admin's DMs
+	}
+	return messageLink(guildID, p.PromptChannel(), p.MessageID)
+}
@@ -0,0 +1,249 @@
+package bot
+
+import (
+	"bitbot/pb"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/charmbracelet/log"
+)
+
+// Approval policies make high-risk tools need several approvers before they
+// run (e.g. two admins for anything on the "prod" server). A call of a tool
+// matching any approval policy always goes through the confirmation flow; the
+// rule is captured on the pending action when it is requested, every vote is
+// recorded in approval_votes, and the tool runs once the quorum is reached.
+
+// approvalRuleFor combines every approval policy matching t into one rule (the
+// strictest of each setting), or returns nil if none match. When the policies
+// cannot be loaded it returns an error, and the call must not run: it might
+// need approvers.
+func approvalRuleFor(t *registeredTool) (*pb.ApprovalPolicy, error) {
+	policies, err := pb.ListApprovalPolicies()
+	if err != nil {
+		log.Errorf("Failed to load approval policies: %v", err)
+		return nil, fmt.Errorf("could not check approval policies for %q; try again later", t.Name)
+	}
+	var rule *pb.ApprovalPolicy
+	var roles []string
+	for _, p := range policies {
+		if !matchesToolTarget(p.Tool, p.Server, t) {
+			continue
+		}
+		if rule == nil {
+			rule = &pb.ApprovalPolicy{}
+		}
+		rule.ApproversRequired = max(rule.ApproversRequired, p.ApproversRequired, 1)
+		rule.ExcludeRequester = rule.ExcludeRequester || p.ExcludeRequester
+		for _, r := range splitRoleIDs(p.ApproverRoles) {
+			if !slices.Contains(roles, r) {
+				roles = append(roles, r)
+			}
+		}
+	}
+	if rule != nil {
+		rule.ApproverRoles = strings.Join(roles, ",")
+	}
+	return rule, nil
+}
+
+func splitRoleIDs(s string) []string {
+	var out []string
+	for _, r := range strings.Split(s, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// canVote reports whether voterID may approve p, with the reason if not.
+func canVote(s *discordgo.Session, guildID, voterID string, p *pb.PendingAction) (bool, string) {
+	if p.ExcludeRequester && voterID == p.UserID {
+		return false, "You requested this action, so someone else must approve it."
+	}
+	if roles := splitRoleIDs(p.ApproverRoles); len(roles) > 0 {
+		if guildID != "" {
+			if member, err := s.GuildMember(guildID, voterID); err == nil {
+				for _, r := range member.Roles {
+					if slices.Contains(roles, r) {
+						return true, ""
+					}
+				}
+			}
+		}
+		return false, "Only members of " + roleMentions(roles) + " can approve this action."
+	}
+	if !authorizeSSH(s, guildID, voterID) {
+		return false, "Only an admin can confirm or cancel this action."
+	}
+	return true, ""
+}
+
+func roleMentions(ids []string) string {
+	m := make([]string, len(ids))
+	for i, id := range ids {
+		m[i] = "<@&" + id + ">"
+	}
+	return strings.Join(m, ", ")
+}
+
+func userMentions(ids []string) string {
+	m := make([]string, len(ids))
+	for i, id := range ids {
+		m[i] = "<@" + id + ">"
+	}
+	return strings.Join(m, ", ")
+}
+
+// approvalFooter describes who must approve p, for the prompt message.
+func approvalFooter(p *pb.PendingAction, approvers []string) string {
+	who := "An admin"
+	if roles := splitRoleIDs(p.ApproverRoles); len(roles) > 0 {
+		who = "A member of " + roleMentions(roles)
+	}
+	if p.RequiredApprovals <= 1 {
+		if p.ExcludeRequester {
+			who += " other than the requester"
+		}
+		return fmt.Sprintf("%s must confirm (expires <t:%d:R>).", who, p.ExpiresAt.Unix())
+	}
+	footer := fmt.Sprintf("Needs %d approvals", p.RequiredApprovals)
+	if p.ExcludeRequester {
+		footer += " (not the requester)"
+	}
+	footer += fmt.Sprintf(" — %d/%d", len(approvers), p.RequiredApprovals)
+	if len(approvers) > 0 {
+		footer += ": " + userMentions(approvers)
+	}
+	return fmt.Sprintf("%s (expires <t:%d:R>).", footer, p.ExpiresAt.Unix())
+}
+
+// approveVoters returns the IDs of voters who approved, in vote order.
+func approveVoters(votes []*pb.ApprovalVote) []string {
+	var out []string
+	for _, v := range votes {
+		if v.Vote == pb.VoteApprove {
+			out = append(out, v.VoterID)
+		}
+	}
+	return out
+}
+
+// --- /tools approval ---
+
+var roleIDPattern = regexp.MustCompile(`\d{15,21}`)
+
+// minApprovers is the lower bound of the /tools approval add "approvers" option.
+var minApprovers = 1.0
+
+func handleApprovalPolicyCommand(s *discordgo.Session, i *discordgo.InteractionCreate, options []*discordgo.ApplicationCommandInteractionDataOption) {
+	var roles []string
+	if i.Member != nil {
+		roles = i.Member.Roles
+	}
+	caller := getUserID(i)
+	if !CheckAdmin(caller, roles) {
+		respondWithMessage(s, i, "You are not authorized to manage approval policies.")
+		return
+	}
+	if len(options) == 0 {
+		respondWithMessage(s, i, "Unknown approval subcommand.")
+		return
+	}
+	sub := options[0]
+	switch sub.Name {
+	case "add":
+		respondWithMessage(s, i, addApprovalPolicy(caller, sub.Options))
+	case "remove":
+		id := ""
+		for _, o := range sub.Options {
+			if o.Name == "id" {
+				id = o.StringValue()
+			}
+		}
+		if err := pb.DeleteApprovalPolicy(id); err != nil {
+			respondWithMessage(s, i, "Could not find that approval policy.")
+			return
+		}
+		respondWithMessage(s, i, fmt.Sprintf("Approval policy `%s` removed.", id))
+	case "list":
+		respondWithMessage(s, i, approvalPolicyListReport())
+	default:
+		respondWithMessage(s, i, "Unknown approval subcommand.")
+	}
+}
+
+// addApprovalPolicy processes /tools approval add and returns the reply.
+func addApprovalPolicy(caller string, options []*discordgo.ApplicationCommandInteractionDataOption) string {
+	p := &pb.ApprovalPolicy{CreatedBy: caller, ApproversRequired: 2, ExcludeRequester: true}
+	for _, o := range options {
+		switch o.Name {
+		case "tool":
+			p.Tool = strings.TrimSpace(o.StringValue())
+		case "server":
+			p.Server = strings.TrimSpace(o.StringValue())
+		case "approvers":
+			p.ApproversRequired = int(o.IntValue())
+		case "exclude_requester":
+			p.ExcludeRequester = o.BoolValue()
+		case "roles":
+			p.ApproverRoles = strings.Join(roleIDPattern.FindAllString(o.StringValue(), -1), ",")
+		}
+	}
+	if p.Tool == "" && p.Server == "" {
+		return "Give a `tool` (name or glob) and/or a `server` (MCP server name, or `local` for built-in tools)."
+	}
+	if p.Tool != "" {
+		if _, err := path.Match(p.Tool, ""); err != nil {
+			return fmt.Sprintf("Invalid tool pattern %q.", p.Tool)
+		}
+	}
+	if p.ApproversRequired < 1 {
+		return "`approvers` must be at least 1."
+	}
+	if err := pb.CreateApprovalPolicy(p); err != nil {
+		log.Errorf("Failed to create approval policy: %v", err)
+		return "Failed to save the approval policy. Please try again."
+	}
+	return "Approval policy added: " + describeApprovalPolicy(p)
+}
+
+func approvalPolicyListReport() string {
+	policies, err := pb.ListApprovalPolicies()
+	if err != nil {
+		log.Errorf("Failed to list approval policies: %v", err)
+		return "Could not fetch approval policies. Please try again later."
+	}
+	if len(policies) == 0 {
+		return "No approval policies. Destructive tools need one admin's confirmation."
+	}
+	var sb strings.Builder
+	sb.WriteString("**Approval policies** (the strictest matching rule applies):\n")
+	for _, p := range policies {
+		sb.WriteString("• " + describeApprovalPolicy(p) + "\n")
+	}
+	return truncateToLimit(sb.String(), discordMessageLimit)
+}
+
+func describeApprovalPolicy(p *pb.ApprovalPolicy) string {
+	var target []string
+	if p.Tool != "" {
+		target = append(target, fmt.Sprintf("tool `%s`", p.Tool))
+	}
+	if p.Server != "" {
+		target = append(target, fmt.Sprintf("server `%s`", p.Server))
+	}
+	desc := fmt.Sprintf("`%s` — %s needs %d approval(s)", p.ID, strings.Join(target, " on "), max(p.ApproversRequired, 1))
+	if p.ExcludeRequester {
+		desc += ", requester excluded"
+	}
+	if roles := splitRoleIDs(p.ApproverRoles); len(roles) > 0 {
+		desc += ", approvers from " + roleMentions(roles)
+	}
+	return desc
+}
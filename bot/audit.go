@@ -0,0 +1,207 @@
+package bot
+
+import (
+	"bitbot/pb"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/charmbracelet/log"
+)
+
+// Every toolbelt invocation goes through invokeTool, which runs the tool and
+// appends an entry to the tool_audit collection: who asked, who approved, where,
+// which tool on which server, the (redacted) arguments, the outcome and how long
+// it took. The call is also counted in tool_usage, for pinning (see
+// tool_pinning.go).
+
+const (
+	auditArgsLimit    = 4000
+	auditExcerptLimit = 500
+	auditListLimit    = 20
+)
+
+// invokeTool runs t for callerID and records the invocation. approverID is the
+// admin who confirmed it, or "" when it ran directly.
+func invokeTool(ctx context.Context, t *registeredTool, callerID, approverID, channelID, guildID string, args map[string]any) (string, error) {
+	start := time.Now()
+	result, err := t.Invoke(ctx, callerID, channelID, guildID, args)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("%s did not finish within its time limit of %s", t.Name, formatDuration(toolTimeout(t)))
+	}
+
+	entry := &pb.ToolAuditEntry{
+		CallerID:   callerID,
+		ApproverID: approverID,
+		ChannelID:  channelID,
+		GuildID:    guildID,
+		Tool:       t.Name,
+		Server:     toolServer(t),
+		Args:       truncateToLimit(redactedArgsJSON(args), auditArgsLimit),
+		Status:     resultStatus(result, err),
+		DurationMS: time.Since(start).Milliseconds(),
+		CreatedAt:  start,
+	}
+	if err != nil {
+		entry.Excerpt = truncateToLimit(err.Error(), auditExcerptLimit)
+	} else {
+		entry.Excerpt = truncateToLimit(result, auditExcerptLimit)
+	}
+	if aerr := pb.RecordToolAudit(entry); aerr != nil {
+		log.Errorf("Failed to record audit entry for %s: %v", t.Name, aerr)
+	}
+	if uerr := pb.RecordToolUse(callerID, channelID, entry.Server, t.Name); uerr != nil {
+		log.Errorf("Failed to record use of %s: %v", t.Name, uerr)
+	}
+	return result, err
+}
+
+// resultStatus classifies a tool outcome: a Go error or a JSON result with
+// "status":"error" is an error, anything else a success.
+func resultStatus(result string, err error) string {
+	if err != nil {
+		return "error"
+	}
+	var r struct {
+		Status string `json:"status"`
+	}
+	if json.Unmarshal([]byte(result), &r) == nil && r.Status == "error" {
+		return "error"
+	}
+	return "success"
+}
+
+// secretArgMarkers are substrings of argument names whose values are never
+// written to the audit log.
+var secretArgMarkers = []string{"password", "passwd", "secret", "token", "authorization", "api_key", "apikey", "private_key", "credential"}
+
+// redactedArgsJSON encodes args with secret-looking values (at any depth)
+// replaced by "[redacted]".
+func redactedArgsJSON(args map[string]any) string {
+	b, err := json.Marshal(redactValue(args))
+	if err != nil {
+		return "{}"
+	}
+	return string(b)
+}
+
+func redactValue(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, x := range val {
+			if isSecretArg(k) {
+				out[k] = "[redacted]"
+			} else {
+				out[k] = redactValue(x)
+			}
+		}
+		return out
+	case []any:
+		out := make([]any, len(val))
+		for i, x := range val {
+			out[i] = redactValue(x)
+		}
+		return out
+	}
+	return v
+}
+
+func isSecretArg(name string) bool {
+	n := strings.ToLower(name)
+	for _, m := range secretArgMarkers {
+		if strings.Contains(n, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleAuditCommand handles /audit, which shows recent tool invocations.
+// Admin only.
+func HandleAuditCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	var roles []string
+	if i.Member != nil {
+		roles = i.Member.Roles
+	}
+	if !CheckAdmin(getUserID(i), roles) {
+		respondWithMessage(s, i, "You are not authorized to view the audit log.")
+		return
+	}
+
+	var f pb.ToolAuditFilter
+	for _, o := range i.ApplicationCommandData().Options {
+		var err error
+		switch o.Name {
+		case "user":
+			f.UserID = o.UserValue(nil).ID
+		case "tool":
+			f.Tool = strings.TrimSpace(o.StringValue())
+		case "since":
+			f.Since, err = parseAuditTime(o.StringValue())
+		case "until":
+			f.Until, err = parseAuditTime(o.StringValue())
+		}
+		if err != nil {
+			respondWithMessage(s, i, fmt.Sprintf("Invalid `%s`: %v", o.Name, err))
+			return
+		}
+	}
+
+	entries, err := pb.QueryToolAudit(f, auditListLimit)
+	if err != nil {
+		log.Errorf("Failed to query audit log: %v", err)
+		respondWithMessage(s, i, "Could not fetch the audit log. Please try again later.")
+		return
+	}
+	respondWithMessage(s, i, auditReport(entries))
+}
+
+// parseAuditTime accepts a lookback ("30m", "24h", "7d") or a date/time
+// ("2006-01-02", "2006-01-02 15:04", RFC3339) in the reminder time zone.
+func parseAuditTime(v string) (time.Time, error) {
+	v = strings.TrimSpace(v)
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil {
+			return time.Now().AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, v, reminderLocation); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("use a lookback like '24h' or '7d', or a date like '2006-01-02'")
+}
+
+func auditReport(entries []*pb.ToolAuditEntry) string {
+	if len(entries) == 0 {
+		return "No matching tool invocations."
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("**Tool audit log** (newest %d):\n", len(entries)))
+	for _, e := range entries {
+		icon := "✅"
+		if e.Status != "success" {
+			icon = "⚠️"
+		}
+		line := fmt.Sprintf("%s %s `%s` (%s) by <@%s>", icon, e.CreatedAt.In(reminderLocation).Format("Jan 2 15:04"), e.Tool, e.Server, e.CallerID)
+		if e.ApproverID != "" {
+			line += fmt.Sprintf(", approved by <@%s>", e.ApproverID)
+		}
+		if e.ChannelID != "" {
+			line += fmt.Sprintf(" in <#%s>", e.ChannelID)
+		}
+		line += fmt.Sprintf(" — %dms\n  args: `%s`\n", e.DurationMS, strings.ReplaceAll(truncateToLimit(e.Args, 150), "`", "'"))
+		sb.WriteString(line)
+	}
+	return truncateToLimit(sb.String(), discordMessageLimit)
+}
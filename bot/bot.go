@@ -121,9 +121,135 @@ var (
 				},
 			},
 		},
+		{
+			Name:        "schedule",
+			Description: "Schedule prompts that the AI runs for you.",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "add",
+					Description: "Schedule a prompt to run through the AI (with your tool access).",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{Type: discordgo.ApplicationCommandOptionString, Name: "when", Description: "When to run (e.g., 'every weekday at 9am', 'every 6h', 'tomorrow at 8pm').", Required: true},
+						{Type: discordgo.ApplicationCommandOptionString, Name: "prompt", Description: "What to ask the AI each time it runs.", Required: true},
+						{
+							Type: discordgo.ApplicationCommandOptionChannel, Name: "channel",
+							Description: "Channel to post the result in (default: this channel).", Required: false,
+							ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+						},
+					},
+				},
+				{Name: "list", Description: "List your scheduled prompts.", Type: discordgo.ApplicationCommandOptionSubCommand},
+				{
+					Name:        "delete",
+					Description: "Delete one of your scheduled prompts.",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{Type: discordgo.ApplicationCommandOptionString, Name: "id", Description: "The ID of the scheduled prompt (from /schedule list).", Required: true},
+					},
+				},
+			},
+		},
+		{
+			Name:        "tools",
+			Description: "Manage toolbelt tools.",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "run",
+					Description: "Run a toolbelt tool directly, filling in its arguments in a form.",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{Type: discordgo.ApplicationCommandOptionString, Name: "tool", Description: "The tool (start typing to search).", Required: true, Autocomplete: true},
+					},
+				},
+				{
+					Name:        "policy",
+					Description: "Allow or deny tools for roles, users, channels or guilds (admin only).",
+					Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "add",
+							Description: "Add a tool policy. Give one subject and a tool and/or server.",
+							Type:        discordgo.ApplicationCommandOptionSubCommand,
+							Options: []*discordgo.ApplicationCommandOption{
+								{Type: discordgo.ApplicationCommandOptionString, Name: "effect", Description: "allow or deny (deny wins).", Required: true, Choices: policyEffectChoices},
+								{Type: discordgo.ApplicationCommandOptionString, Name: "tool", Description: "Tool name or glob (e.g. 'execute_ssh_command', '*_backup').", Required: false},
+								{Type: discordgo.ApplicationCommandOptionString, Name: "server", Description: "MCP server name, or 'local' for built-in tools.", Required: false},
+								{Type: discordgo.ApplicationCommandOptionRole, Name: "role", Description: "Apply to members with this role.", Required: false},
+								{Type: discordgo.ApplicationCommandOptionUser, Name: "user", Description: "Apply to this user.", Required: false},
+								{Type: discordgo.ApplicationCommandOptionChannel, Name: "channel", Description: "Apply to calls made in this channel.", Required: false},
+								{Type: discordgo.ApplicationCommandOptionString, Name: "guild_id", Description: "Apply to calls made in this guild (server ID).", Required: false},
+							},
+						},
+						{
+							Name:        "remove",
+							Description: "Remove a tool policy.",
+							Type:        discordgo.ApplicationCommandOptionSubCommand,
+							Options: []*discordgo.ApplicationCommandOption{
+								{Type: discordgo.ApplicationCommandOptionString, Name: "id", Description: "The policy ID (from /tools policy list).", Required: true},
+							},
+						},
+						{Name: "list", Description: "List tool policies.", Type: discordgo.ApplicationCommandOptionSubCommand},
+					},
+				},
+				{
+					Name:        "approval",
+					Description: "Require several approvers for high-risk tools (admin only).",
+					Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "add",
+							Description: "Add an approval policy for a tool and/or server.",
+							Type:        discordgo.ApplicationCommandOptionSubCommand,
+							Options: []*discordgo.ApplicationCommandOption{
+								{Type: discordgo.ApplicationCommandOptionString, Name: "tool", Description: "Tool name or glob.", Required: false},
+								{Type: discordgo.ApplicationCommandOptionString, Name: "server", Description: "MCP server name, or 'local' for built-in tools.", Required: false},
+								{Type: discordgo.ApplicationCommandOptionInteger, Name: "approvers", Description: "Number of distinct approvers required (default 2).", Required: false, MinValue: &minApprovers, MaxValue: 10},
+								{Type: discordgo.ApplicationCommandOptionBoolean, Name: "exclude_requester", Description: "The requester cannot approve their own call (default true).", Required: false},
+								{Type: discordgo.ApplicationCommandOptionString, Name: "roles", Description: "Only these roles may approve (mention them); default: admins.", Required: false},
+							},
+						},
+						{
+							Name:        "remove",
+							Description: "Remove an approval policy.",
+							Type:        discordgo.ApplicationCommandOptionSubCommand,
+							Options: []*discordgo.ApplicationCommandOption{
+								{Type: discordgo.ApplicationCommandOptionString, Name: "id", Description: "The policy ID (from /tools approval list).", Required: true},
+							},
+						},
+						{Name: "list", Description: "List approval policies.", Type: discordgo.ApplicationCommandOptionSubCommand},
+					},
+				},
+			},
+		},
+		{
+			Name:        "audit",
+			Description: "Show recent toolbelt tool invocations (admin only).",
+			Options: []*discordgo.ApplicationCommandOption{
+				{Type: discordgo.ApplicationCommandOptionUser, Name: "user", Description: "Only invocations requested or approved by this user.", Required: false},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "tool", Description: "Only this tool (exact name).", Required: false},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "since", Description: "Start of range: a lookback like '24h' or '7d', or a date like '2025-01-31'.", Required: false},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "until", Description: "End of range, same formats as 'since'.", Required: false},
+			},
+		},
+		{
+			Name:        "pending",
+			Description: "List tool calls and access requests waiting for approval.",
+		},
+		{
+			Name:        "reasoning",
+			Description: "Set how model reasoning is shown in this channel (admin only).",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type: discordgo.ApplicationCommandOptionString, Name: "mode",
+					Description: "Display mode (omit to show the current one).", Required: false,
+					Choices: reasoningModeChoices,
+				},
+			},
+		},
 		{
 			Name:        "mcp",
-			Description: "Manage MCP tool servers (admin only).",
+			Description: "Manage MCP tool servers (admin only; anyone can link OAuth servers).",
 			Options: []*discordgo.ApplicationCommandOption{
 				{
 					Name:        "add",
@@ -145,14 +271,61 @@ var (
 						},
 					},
 				},
+				{
+					Name:        "add_command",
+					Description: "Add an MCP server that runs as a local command over stdio.",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{Type: discordgo.ApplicationCommandOptionString, Name: "name", Description: "Unique name for the server.", Required: true},
+						{Type: discordgo.ApplicationCommandOptionString, Name: "command", Description: "Executable to run, e.g. npx or /usr/local/bin/server.", Required: true},
+						{Type: discordgo.ApplicationCommandOptionString, Name: "args", Description: "Arguments, space-separated (quote ones with spaces).", Required: false},
+						{Type: discordgo.ApplicationCommandOptionString, Name: "env", Description: "Environment as 'NAME=value; OTHER=value'.", Required: false},
+						{Type: discordgo.ApplicationCommandOptionString, Name: "cwd", Description: "Working directory for the process.", Required: false},
+						{
+							Type: discordgo.ApplicationCommandOptionString, Name: "visibility",
+							Description: "Who can use these tools (default: private to you).", Required: false,
+							Choices: mcpVisibilityChoices,
+						},
+					},
+				},
 				{
 					Name:        "link",
-					Description: "Authorize and connect one of your OAuth MCP servers.",
+					Description: "Link your account to an OAuth MCP server, so its tools run as you.",
 					Type:        discordgo.ApplicationCommandOptionSubCommand,
 					Options: []*discordgo.ApplicationCommandOption{
 						{Type: discordgo.ApplicationCommandOptionString, Name: "name", Description: "Name of the OAuth server to link.", Required: true},
 					},
 				},
+				{
+					Name:        "unlink",
+					Description: "Delete your stored authorization for an OAuth MCP server.",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{Type: discordgo.ApplicationCommandOptionString, Name: "name", Description: "Name of the OAuth server to unlink.", Required: true},
+					},
+				},
+				{
+					Name:        "timeout",
+					Description: "Set how long calls of one of your MCP servers' tools may run.",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{Type: discordgo.ApplicationCommandOptionString, Name: "name", Description: "Name of the server.", Required: true},
+						{Type: discordgo.ApplicationCommandOptionInteger, Name: "seconds", Description: "Time limit in seconds (0 for the default).", Required: true, MinValue: &minToolTimeoutSeconds, MaxValue: maxToolTimeout.Seconds()},
+						{Type: discordgo.ApplicationCommandOptionString, Name: "tool", Description: "Only this tool (default: every tool without its own timeout).", Required: false},
+					},
+				},
+				{
+					Name:        "sampling",
+					Description: "Let one of your MCP servers run completions on the bot's model.",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{Type: discordgo.ApplicationCommandOptionString, Name: "name", Description: "Name of the server.", Required: true},
+						{Type: discordgo.ApplicationCommandOptionBoolean, Name: "enabled", Description: "Whether the server may use the bot's model.", Required: true},
+						{Type: discordgo.ApplicationCommandOptionInteger, Name: "max_tokens", Description: "Most tokens one request may generate (default 1024).", Required: false, MinValue: &samplingMinTokens, MaxValue: maxSamplingMaxTokens},
+						{Type: discordgo.ApplicationCommandOptionInteger, Name: "daily_tokens", Description: "Most tokens the server may use over 24 hours (default: no limit).", Required: false, MinValue: &samplingMinTokens},
+						{Type: discordgo.ApplicationCommandOptionBoolean, Name: "approval", Description: "Require an admin's approval for each request (default: no).", Required: false},
+					},
+				},
 				{
 					Name:        "remove",
 					Description: "Remove one of your MCP servers and its tools.",
@@ -175,9 +348,48 @@ var (
 					},
 				},
 				{Name: "list", Description: "List configured MCP servers and their status.", Type: discordgo.ApplicationCommandOptionSubCommand},
+				{
+					Name:        "status",
+					Description: "Show a server's health, capabilities and instructions.",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{Type: discordgo.ApplicationCommandOptionString, Name: "name", Description: "Name of the server.", Required: true},
+					},
+				},
 				{Name: "reload", Description: "Re-sync MCP servers from the database now.", Type: discordgo.ApplicationCommandOptionSubCommand},
 			},
 		},
+		{
+			Name:        "prompt",
+			Description: "Run a prompt from a connected MCP server.",
+			Options: []*discordgo.ApplicationCommandOption{
+				{Type: discordgo.ApplicationCommandOptionString, Name: "name", Description: "The prompt (start typing to search).", Required: true, Autocomplete: true},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "arguments", Description: "Prompt arguments as 'name=value; other=value'.", Required: false},
+			},
+		},
+		{
+			Name:        "apitoken",
+			Description: "Manage your API tokens for bitbot's MCP endpoint.",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "create",
+					Description: "Create a token (shown once).",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{Type: discordgo.ApplicationCommandOptionString, Name: "name", Description: "A label for the token, e.g. 'laptop IDE'.", Required: false},
+					},
+				},
+				{Name: "list", Description: "List your tokens.", Type: discordgo.ApplicationCommandOptionSubCommand},
+				{
+					Name:        "revoke",
+					Description: "Revoke one of your tokens.",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{Type: discordgo.ApplicationCommandOptionString, Name: "id", Description: "The token ID (from /apitoken list).", Required: true},
+					},
+				},
+			},
+		},
 	}
 	// registeredCommands is a map to keep track of registered commands and avoid re-registering.
 	// This might be useful if registerCommands is called multiple times, though typically it's once at startup.
@@ -218,6 +430,8 @@ func Run() {
 	// Register extended tools behind the toolbelt: SSH tools locally, plus any
 	// tools exposed by a configured remote MCP server (non-fatal if unreachable).
 	registerSSHTools()
+	registerToolOutputTools()
+	registerMCPResourceTools()
 	InitMCP(context.Background())
 
 	discord.AddHandler(commandHandler)
@@ -231,12 +445,16 @@ func Run() {
 		log.Fatal(err)
 	}
 	defer discord.Close()
+	botSession.Store(discord)
 
 	log.Info("Registering commands...")
 	registerCommands(discord, AppId)
 	log.Info("BitBot is running...")
 
 	go StartReminderScheduler(discord)
+	go StartPromptScheduler(discord)
+	go StartToolOutputCleanup()
+	go StartPendingActionSweeper(discord)
 
 	log.Info("Exiting... press CTRL + c again")
 
@@ -279,9 +497,10 @@ func newMessage(discord *discordgo.Session, message *discordgo.MessageCreate) {
 	// Passive listening: record every human message (attributed to its speaker)
 	// so the bot has full channel context and can answer "who said what" even for
 	// messages that were not addressed to it.
-	recordMessage(message.ChannelID, message.Author.ID, resolveDisplayName(message), message.Content)
+	addressed := strings.HasPrefix(message.Content, "!bit") || isPrivateChannel
+	recordMessage(message.ChannelID, message.Author.ID, resolveDisplayName(message), message.Content, addressed)
 
-	if strings.HasPrefix(message.Content, "!bit") || isPrivateChannel {
+	if addressed {
 		chatbot(discord, message.Author.ID, message.ChannelID, message.GuildID)
 	}
 
@@ -462,6 +681,11 @@ func commandHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 				"      Use '@me' for yourself in <who>.\n" +
 				"    /remind list - List your reminders.\n" +
 				"    /remind delete <id> - Delete a reminder by its ID.\n" +
+				"/schedule add|list|delete - Schedule prompts the AI runs for you (e.g. 'every weekday at 9am').\n" +
+				"/pending - List tool calls and access requests waiting for approval (admins see all).\n" +
+				"/prompt <name> [arguments] - Run a prompt from a connected MCP server.\n" +
+				"/tools run <tool> - Run a toolbelt tool directly, filling in its arguments in a form.\n" +
+				"/apitoken create|list|revoke - Manage your API tokens for bitbot's MCP endpoint.\n" +
 				"/help - Show available commands.\n"
 			if len(data.Options) > 0 && data.Options[0].StringValue() == "admin" {
 				helpMessage += "Admin commands:\n" +
@@ -472,17 +696,55 @@ func commandHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 					"/exe - Execute a command on the remote server.\n" +
 					"/exit - Close the SSH connection.\n" +
 					"/list - List saved servers.\n" +
-					"/mcp add|remove|access|list|reload - Manage MCP tool servers.\n"
+					"/mcp add|add_command|link|unlink|timeout|sampling|remove|access|list|status|reload - Manage MCP tool servers.\n" +
+					"/tools policy add|remove|list - Allow or deny toolbelt tools per role, user, channel or guild.\n" +
+					"/tools approval add|remove|list - Require several approvers for high-risk tools.\n" +
+					"/audit [user] [tool] [since] [until] - Show recent toolbelt tool invocations.\n" +
+					"/reasoning [mode] - Show model reasoning in this channel: off, spoiler (visible to the whole channel), or an admin-only button.\n"
 			}
 			respondWithMessage(s, i, helpMessage)
 
 		case "remind":
 			HandleRemindCommand(s, i)
 
+		case "schedule":
+			HandleScheduleCommand(s, i)
+
+		case "tools":
+			HandleToolsCommand(s, i)
+
+		case "audit":
+			HandleAuditCommand(s, i)
+
+		case "pending":
+			HandlePendingCommand(s, i)
+
+		case "reasoning":
+			HandleReasoningCommand(s, i)
+
 		case "mcp":
 			HandleMCPCommand(s, i)
+
+		case "apitoken":
+			HandleAPITokenCommand(s, i)
+
+		case "prompt":
+			HandlePromptCommand(s, i)
+		}
+	} else if i.Type == discordgo.InteractionApplicationCommandAutocomplete {
+		switch i.ApplicationCommandData().Name {
+		case "prompt":
+			HandlePromptAutocomplete(s, i)
+		case "tools":
+			HandleToolsAutocomplete(s, i)
 		}
 	} else if i.Type == discordgo.InteractionModalSubmit {
+		if handleElicitationModal(s, i) {
+			return
+		}
+		if handleToolRunModal(s, i) {
+			return
+		}
 		modalHandler(s, i)
 	}
 }
@@ -565,6 +827,7 @@ func respondWithMessage(s *discordgo.Session, i *discordgo.InteractionCreate, me
 		response = &discordgo.InteractionResponseData{
 			Content: v.Content,
 			Embeds:  v.Embeds,
+			Files:   v.Files,
 			Flags:   discordgo.MessageFlagsEphemeral,
 		}
 	default:
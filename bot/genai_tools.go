@@ -185,18 +185,38 @@ func jsonResult(status, message string) string {
 	return string(b)
 }
 
+// topLevelToolSchema returns the parameter schema of a tool offered directly
+// to the model (reminders and the toolbelt meta-tools), or nil if unknown.
+func topLevelToolSchema(name string) any {
+	for _, set := range [][]Tool{ReminderTools, ToolbeltTools} {
+		for _, t := range set {
+			if t.Function.Name == name {
+				return t.Function.Parameters
+			}
+		}
+	}
+	return nil
+}
+
 // HandleFunctionCallWithContext processes a tool call from the model with explicit
-// user/channel context. It returns a JSON-encoded result string.
-func HandleFunctionCallWithContext(s *discordgo.Session, i *discordgo.InteractionCreate, call *ToolCall, userID, channelID, guildID string) (string, error) {
+// user/channel context. userID is the user who triggered the turn; all tool
+// authorization is checked against them. turn may be nil outside a chat turn.
+// It returns a JSON-encoded result string.
+func HandleFunctionCallWithContext(s *discordgo.Session, i *discordgo.InteractionCreate, call *ToolCall, userID, channelID, guildID string, turn *chatTurn) (string, error) {
 	name := call.Function.Name
 
 	// Parse the JSON arguments string into a map to extract args.
+	// Malformed or schema-violating arguments go back to the model as a
+	// structured error so it can correct the call.
 	args := map[string]any{}
 	if call.Function.Arguments != "" {
-		if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
-			return "", fmt.Errorf("failed to parse arguments for %s: %w", name, err)
+		if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil || args == nil {
+			return jsonResult("error", fmt.Sprintf("arguments for %s must be a JSON object", name)), nil
 		}
 	}
+	if errs := validateArgs(topLevelToolSchema(name), args); len(errs) > 0 {
+		return validationResult(name, errs), nil
+	}
 
 	switch name {
 	case "add_reminder":
@@ -223,12 +243,15 @@ func HandleFunctionCallWithContext(s *discordgo.Session, i *discordgo.Interactio
 		return jsonResult("success", resp), nil
 
 	case "find_tools":
-		return handleFindTools(userID, authorizeSSH(s, guildID, userID), args), nil
+		return handleFindTools(newToolCaller(s, userID, channelID, guildID), args), nil
 
 	case "call_tool":
-		return handleCallTool(s, userID, channelID, guildID, args), nil
+		return handleCallTool(s, userID, channelID, guildID, args, turn), nil
 
 	default:
+		if turn != nil && turn.pinned[name] != "" {
+			return handleCallTool(s, userID, channelID, guildID, map[string]any{"name": turn.pinned[name], "arguments": args}, turn), nil
+		}
 		return "", fmt.Errorf("unknown function call: %s", name)
 	}
 }
@@ -4,8 +4,12 @@ import (
 	"bitbot/pb"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
 	"net/http"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -15,10 +19,10 @@ import (
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
-// mcpReconcileInterval is how often the bot re-syncs its live MCP connections
-// with the mcp_servers collection, so servers added/removed/changed are picked
-// up without a restart.
-const mcpReconcileInterval = 60 * time.Second
+// mcpReconcileInterval is how often the bot pings its live MCP connections and
+// re-syncs them with the mcp_servers collection, so servers added/removed/changed
+// are picked up without a restart.
+const mcpReconcileInterval = 30 * time.Second
 
 // mcpVisibilityChoices are the selectable visibility levels for /mcp add|access.
 var mcpVisibilityChoices = []*discordgo.ApplicationCommandOptionChoice{
@@ -40,6 +44,7 @@ func serverKey(owner, name string) string { return owner + "/" + name }
 // mcpConnection is a live connection to one owner's MCP server plus the tools it
 // contributed to the toolbelt (so they can be removed on disconnect).
 type mcpConnection struct {
+	id         string // mcp_servers record ID
 	key        string
 	owner      string
 	name       string
@@ -47,8 +52,18 @@ type mcpConnection struct {
 	token      string
 	visibility string
 	authMode   string
+	user       string // whose stored token an OAuth connection uses
+	spec       string // commandSpec, for command servers
 	session    *mcp.ClientSession
 	toolNames  []string
+	caps       *mcp.ServerCapabilities // what the server offers besides tools
+	prompts    []*mcp.Prompt           // cached for /prompt autocomplete
+
+	// Guarded by mcpConnectionsMu.
+	timeout      time.Duration // see pb.MCPServer.TimeoutFor
+	toolTimeouts map[string]time.Duration
+	latency      time.Duration
+	pingFailures int
 }
 
 var (
@@ -78,6 +93,7 @@ func InitMCP(ctx context.Context) {
 		ticker := time.NewTicker(mcpReconcileInterval)
 		defer ticker.Stop()
 		for range ticker.C {
+			checkMCPHealth()
 			syncMCPServers(context.Background())
 		}
 	}()
@@ -85,7 +101,8 @@ func InitMCP(ctx context.Context) {
 
 // syncMCPServers reconciles live connections with the mcp_servers collection:
 // connects newly-enabled servers, disconnects removed/disabled ones, and
-// reconnects any whose URL, token, or visibility changed.
+// reconnects any whose URL, token, or visibility changed. Servers that failed to
+// connect are retried with backoff (see mcp_health.go).
 func syncMCPServers(ctx context.Context) {
 	servers, err := pb.ListMCPServers()
 	if err != nil {
@@ -95,9 +112,11 @@ func syncMCPServers(ctx context.Context) {
 
 	desired := map[string]*pb.MCPServer{}
 	for _, srv := range servers {
-		// OAuth servers are connected per-user via /mcp link, not by the startup
-		// reconciler (they have no token until a user authorizes).
-		if srv.Enabled && srv.AuthMode != pb.MCPAuthOAuth && strings.TrimSpace(srv.URL) != "" {
+		if !srv.Enabled {
+			continue
+		}
+		if srv.Transport == pb.MCPTransportCommand && strings.TrimSpace(srv.Command) != "" ||
+			srv.Transport == pb.MCPTransportHTTP && strings.TrimSpace(srv.URL) != "" {
 			desired[serverKey(srv.Owner, srv.Name)] = srv
 		}
 	}
@@ -110,15 +129,13 @@ func syncMCPServers(ctx context.Context) {
 	mcpConnectionsMu.Unlock()
 
 	// Remove connections no longer desired (deleted, disabled, or reconfigured).
-	// OAuth connections are managed by /mcp link, not the reconciler, so leave them.
 	for key, conn := range current {
-		if conn.authMode == pb.MCPAuthOAuth {
-			continue
-		}
 		want, ok := desired[key]
-		if !ok || want.URL != conn.url || want.Token != conn.token || want.Visibility != conn.visibility {
+		if !ok || want.URL != conn.url || want.Token != conn.token || want.Visibility != conn.visibility || commandSpec(want) != conn.spec {
 			disconnectMCPServer(key)
+			continue
 		}
+		conn.setTimeouts(want)
 	}
 
 	// Add connections that are desired but not yet live.
@@ -126,35 +143,83 @@ func syncMCPServers(ctx context.Context) {
 		mcpConnectionsMu.Lock()
 		_, live := mcpConnections[key]
 		mcpConnectionsMu.Unlock()
-		if live {
+		if live || isRestarting(key) || !retryDue(key) {
+			continue
+		}
+		err := connectMCPServer(ctx, srv)
+		if errors.Is(err, errOAuthNotLinked) || errors.Is(err, errOAuthReauth) {
+			// Waiting on a user to run /mcp link; they were told if needed.
 			continue
 		}
-		if err := connectMCPServer(ctx, srv); err != nil {
-			log.Errorf("MCP reconcile: connect %q (%s) failed: %v", srv.Name, srv.URL, err)
+		if err != nil {
+			noteMCPFailure(srv.ID, key, srv.Name, fmt.Errorf("connect to %s failed: %w", serverLocation(srv), err))
 		}
 	}
 }
 
+// newMCPClient returns the client used for every server connection. It keeps
+// a server's tools and prompts current when the server announces changes,
+// relays progress of long tool calls, puts servers' requests for more input to
+// the calling user, and serves sampling requests from servers that were opted
+// in.
+func newMCPClient() *mcp.Client {
+	return mcp.NewClient(&mcp.Implementation{Name: "bitbot", Version: "1.0.0"}, &mcp.ClientOptions{
+		// Handlers run on the session's read loop, which must stay free to
+		// deliver the responses the refresh waits for.
+		ToolListChangedHandler: func(_ context.Context, req *mcp.ToolListChangedRequest) {
+			go refreshServerTools(req.Session)
+		},
+		PromptListChangedHandler: func(_ context.Context, req *mcp.PromptListChangedRequest) {
+			go refreshServerPrompts(req.Session)
+		},
+		ProgressNotificationHandler: handleProgress,
+		ElicitationHandler:          handleElicitation,
+		CreateMessageHandler:        handleSampling,
+	})
+}
+
 // connectMCPServer connects to one server, lists its tools, and registers them
-// into the toolbelt tagged with the owner and visibility.
+// into the toolbelt tagged with the owner and visibility. Command servers are
+// then supervised, so they are restarted if their process exits. OAuth servers
+// are connected with a linked user's stored token.
 func connectMCPServer(ctx context.Context, srv *pb.MCPServer) error {
-	httpClient := &http.Client{Transport: http.DefaultTransport}
-	if srv.Token != "" {
-		httpClient.Transport = &bearerTransport{token: srv.Token, base: http.DefaultTransport}
+	if srv.AuthMode == pb.MCPAuthOAuth {
+		return connectOAuthServer(ctx, srv)
+	}
+	session, err := openMCPServer(ctx, srv)
+	if err != nil {
+		return err
+	}
+	if srv.Transport == pb.MCPTransportCommand {
+		go superviseCommandServer(srv, session)
 	}
+	return nil
+}
 
-	transport := &mcp.StreamableClientTransport{
-		Endpoint:             srv.URL,
-		HTTPClient:           httpClient,
-		DisableStandaloneSSE: true, // request/response only; no server-initiated stream
+// openMCPServer connects to srv over its transport and registers its tools.
+func openMCPServer(ctx context.Context, srv *pb.MCPServer) (*mcp.ClientSession, error) {
+	var transport mcp.Transport
+	if srv.Transport == pb.MCPTransportCommand {
+		transport = commandTransport(srv)
+	} else {
+		httpClient := &http.Client{Transport: http.DefaultTransport}
+		if srv.Token != "" {
+			httpClient.Transport = &bearerTransport{token: srv.Token, base: http.DefaultTransport}
+		}
+		// The standalone SSE stream (on by default) carries server notifications
+		// such as tools/list_changed.
+		transport = &mcp.StreamableClientTransport{
+			Endpoint:   srv.URL,
+			HTTPClient: httpClient,
+		}
 	}
-	client := mcp.NewClient(&mcp.Implementation{Name: "bitbot", Version: "1.0.0"}, nil)
+	client := newMCPClient()
 
 	connectCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
 	defer cancel()
 	session, err := client.Connect(connectCtx, transport, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	listCtx, cancel2 := context.WithTimeout(ctx, 20*time.Second)
@@ -162,46 +227,165 @@ func connectMCPServer(ctx context.Context, srv *pb.MCPServer) error {
 	res, err := session.ListTools(listCtx, nil)
 	if err != nil {
 		session.Close()
-		return err
+		return nil, err
 	}
 
-	registerServerTools(srv, session, res)
-	return nil
+	registerServerTools(srv, session, res, "")
+	return session, nil
 }
 
 // registerServerTools registers a connected server's tools into the toolbelt
 // (tagged with owner and visibility) and stores the live connection. Shared by
-// the bearer reconciler path and the OAuth link path.
-func registerServerTools(srv *pb.MCPServer, session *mcp.ClientSession, res *mcp.ListToolsResult) {
+// the bearer and OAuth paths; user is whose OAuth token the session uses.
+func registerServerTools(srv *pb.MCPServer, session *mcp.ClientSession, res *mcp.ListToolsResult, user string) {
 	key := serverKey(srv.Owner, srv.Name)
-	conn := &mcpConnection{key: key, owner: srv.Owner, name: srv.Name, url: srv.URL, token: srv.Token, visibility: srv.Visibility, authMode: srv.AuthMode, session: session}
+	conn := &mcpConnection{id: srv.ID, key: key, owner: srv.Owner, name: srv.Name, url: srv.URL, token: srv.Token, visibility: srv.Visibility, authMode: srv.AuthMode, user: user, spec: commandSpec(srv), session: session, timeout: srv.Timeout, toolTimeouts: srv.ToolTimeouts}
+	if ir := session.InitializeResult(); ir != nil {
+		conn.caps = ir.Capabilities
+	}
+	if conn.caps != nil && conn.caps.Prompts != nil {
+		conn.prompts = listServerPrompts(session)
+	}
 	for _, tool := range res.Tools {
-		destructive := false
-		if tool.Annotations != nil && tool.Annotations.DestructiveHint != nil {
-			destructive = *tool.Annotations.DestructiveHint
-		}
-		toolName := tool.Name
-		s := session
-		registerTool(&registeredTool{
-			Name:        toolName,
-			Description: tool.Description,
-			InputSchema: tool.InputSchema,
-			Source:      key,
-			Owner:       srv.Owner,
-			Visibility:  srv.Visibility,
-			Destructive: destructive,
-			Invoke: func(ctx context.Context, userID, channelID, guildID string, args map[string]any) (string, error) {
-				return callMCPTool(ctx, s, toolName, args)
-			},
-		})
-		conn.toolNames = append(conn.toolNames, toolName)
+		registerTool(serverTool(conn, tool))
+		conn.toolNames = append(conn.toolNames, tool.Name)
 	}
 
 	mcpConnectionsMu.Lock()
 	mcpConnections[key] = conn
 	mcpConnectionsMu.Unlock()
+	go noteMCPConnected(conn)
+
+	log.Infof("connected MCP server %q owner=%q (%s): registered %d tools", srv.Name, srv.Owner, serverLocation(srv), len(conn.toolNames))
+}
+
+// serverTool wraps one of a connection's tools for the toolbelt.
+func serverTool(conn *mcpConnection, tool *mcp.Tool) *registeredTool {
+	destructive := false
+	if tool.Annotations != nil && tool.Annotations.DestructiveHint != nil {
+		destructive = *tool.Annotations.DestructiveHint
+	}
+	toolName := tool.Name
+	t := &registeredTool{
+		Name:        toolName,
+		Description: tool.Description,
+		InputSchema: tool.InputSchema,
+		Source:      conn.key,
+		Owner:       conn.owner,
+		Visibility:  conn.visibility,
+		Destructive: destructive,
+		Timeout:     conn.timeoutFor(toolName),
+		Invoke: func(ctx context.Context, userID, channelID, guildID string, args map[string]any) (string, error) {
+			session, err := sessionFor(ctx, conn, userID)
+			if err != nil {
+				return "", err
+			}
+			done := trackMCPCall(session, &mcpCall{ctx: ctx, server: conn.name, tool: toolName, userID: userID, channelID: channelID})
+			defer done()
+			result, err := callMCPTool(ctx, session, toolName, args)
+			if errors.Is(err, mcp.ErrConnectionClosed) && session != conn.session {
+				forgetOAuthSession(conn.key, userID, session)
+			}
+			return result, err
+		},
+	}
+	if conn.authMode == pb.MCPAuthOAuth {
+		t.LinkServer = conn.name
+	}
+	return t
+}
+
+// timeoutFor returns how long a call of tool may run, or 0 for the default.
+// The caller holds mcpConnectionsMu, or conn isn't published yet.
+func (conn *mcpConnection) timeoutFor(tool string) time.Duration {
+	srv := pb.MCPServer{Timeout: conn.timeout, ToolTimeouts: conn.toolTimeouts}
+	return srv.TimeoutFor(tool)
+}
+
+// setTimeouts applies changed tool timeouts to a live connection's tools.
+func (conn *mcpConnection) setTimeouts(srv *pb.MCPServer) {
+	mcpConnectionsMu.Lock()
+	defer mcpConnectionsMu.Unlock()
+	if conn.timeout == srv.Timeout && maps.Equal(conn.toolTimeouts, srv.ToolTimeouts) {
+		return
+	}
+	conn.timeout, conn.toolTimeouts = srv.Timeout, srv.ToolTimeouts
+	toolRegistryMu.Lock()
+	defer toolRegistryMu.Unlock()
+	for key, t := range toolRegistry {
+		if t.Source == conn.key {
+			// Registered tools are shared with calls in flight; replace, don't mutate.
+			updated := *t
+			updated.Timeout = srv.TimeoutFor(t.Name)
+			toolRegistry[key] = &updated
+		}
+	}
+}
+
+// connectionFor returns the live connection using session, or nil.
+func connectionFor(session *mcp.ClientSession) *mcpConnection {
+	mcpConnectionsMu.Lock()
+	defer mcpConnectionsMu.Unlock()
+	for _, conn := range mcpConnections {
+		if conn.session == session {
+			return conn
+		}
+	}
+	return nil
+}
+
+// refreshServerTools re-lists a server's tools after it announced a change:
+// new tools are registered, removed ones unregistered, and the rest
+// re-registered so changed descriptions, schemas and annotations apply.
+func refreshServerTools(session *mcp.ClientSession) {
+	conn := connectionFor(session)
+	if conn == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	res, err := session.ListTools(ctx, nil)
+	if err != nil {
+		log.Warnf("MCP server %q owner=%q: failed to refresh tools: %v", conn.name, conn.owner, err)
+		return
+	}
+
+	mcpConnectionsMu.Lock()
+	defer mcpConnectionsMu.Unlock()
+	if mcpConnections[conn.key] != conn {
+		return // disconnected meanwhile
+	}
+	old := make(map[string]bool, len(conn.toolNames))
+	for _, name := range conn.toolNames {
+		old[name] = true
+	}
+	names := make([]string, 0, len(res.Tools))
+	added := 0
+	for _, tool := range res.Tools {
+		if !old[tool.Name] {
+			added++
+		}
+		delete(old, tool.Name)
+		registerTool(serverTool(conn, tool))
+		names = append(names, tool.Name)
+	}
+	for name := range old {
+		unregisterTool(conn.key, name)
+	}
+	conn.toolNames = names
+	log.Infof("MCP server %q owner=%q changed its tools: %d added, %d removed, %d total", conn.name, conn.owner, added, len(old), len(names))
+}
 
-	log.Infof("connected MCP server %q owner=%q (%s): registered %d tools", srv.Name, srv.Owner, srv.URL, len(conn.toolNames))
+// refreshServerPrompts re-lists a server's prompts after it announced a change.
+func refreshServerPrompts(session *mcp.ClientSession) {
+	conn := connectionFor(session)
+	if conn == nil {
+		return
+	}
+	prompts := listServerPrompts(session)
+	mcpConnectionsMu.Lock()
+	conn.prompts = prompts
+	mcpConnectionsMu.Unlock()
 }
 
 // disconnectMCPServer removes a server's tools from the toolbelt and closes its session.
@@ -217,22 +401,21 @@ func disconnectMCPServer(key string) {
 	if conn.session != nil {
 		conn.session.Close()
 	}
+	closeOAuthSessions(key, "")
 	log.Infof("disconnected MCP server %q owner=%q: removed %d tools", conn.name, conn.owner, removed)
 }
 
-// HandleMCPCommand handles the /mcp slash command (admin only). Each admin owns
-// the servers they add; add/remove/access act on the caller's own (or legacy)
-// servers, and list shows what the caller can see.
+// HandleMCPCommand handles the /mcp slash command (admin only, except link and
+// unlink, which anyone uses for the OAuth servers they can see). Each admin
+// owns the servers they add; add/remove/access act on the caller's own (or
+// legacy) servers, and list shows what the caller can see.
 func HandleMCPCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	var roles []string
 	if i.Member != nil {
 		roles = i.Member.Roles
 	}
 	caller := getUserID(i)
-	if !CheckAdmin(caller, roles) {
-		respondWithMessage(s, i, "You are not authorized to manage MCP servers.")
-		return
-	}
+	isAdmin := CheckAdmin(caller, roles)
 
 	data := i.ApplicationCommandData()
 	if len(data.Options) == 0 {
@@ -240,6 +423,10 @@ func HandleMCPCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		return
 	}
 	sub := data.Options[0]
+	if !isAdmin && sub.Name != "link" && sub.Name != "unlink" {
+		respondWithMessage(s, i, "You are not authorized to manage MCP servers.")
+		return
+	}
 	optStr := func(name string) string {
 		for _, o := range sub.Options {
 			if o.Name == name {
@@ -279,15 +466,53 @@ func HandleMCPCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
 			s.ChannelMessageSend(channelID, mcpServerStatusLine(key, name))
 		}()
 
+	case "add_command":
+		name, command := optStr("name"), optStr("command")
+		if name == "" || command == "" {
+			respondWithMessage(s, i, "`/mcp add_command` requires `name` and `command`.")
+			return
+		}
+		args, err := splitCommandLine(optStr("args"))
+		if err != nil {
+			respondWithMessage(s, i, "Invalid `args`: "+err.Error())
+			return
+		}
+		envVars, err := parseKeyValues(optStr("env"))
+		if err != nil {
+			respondWithMessage(s, i, "Invalid `env`: "+err.Error())
+			return
+		}
+		env := make([]string, 0, len(envVars))
+		for k, v := range envVars {
+			env = append(env, k+"="+v)
+		}
+		sort.Strings(env)
+		created, err := pb.AddMCPCommandServer(name, command, args, env, optStr("cwd"), caller, optStr("visibility"))
+		if err != nil {
+			respondWithMessage(s, i, "Failed to add MCP server: "+err.Error())
+			return
+		}
+		if !created {
+			respondWithMessage(s, i, "You already have a server with that name.")
+			return
+		}
+		respondWithMessage(s, i, fmt.Sprintf("Added command MCP server `%s` (owner: you). Starting…", name))
+		channelID := i.ChannelID
+		key := serverKey(caller, name)
+		go func() {
+			syncMCPServers(context.Background())
+			s.ChannelMessageSend(channelID, mcpServerStatusLine(key, name))
+		}()
+
 	case "link":
 		name := optStr("name")
 		if name == "" {
 			respondWithMessage(s, i, "`/mcp link` requires `name`.")
 			return
 		}
-		srv, err := pb.GetMCPServer(name, caller)
+		srv, err := findVisibleServer(caller, isAdmin, name)
 		if err != nil || srv == nil {
-			respondWithMessage(s, i, fmt.Sprintf("No MCP server named `%s` that you can manage.", name))
+			respondWithMessage(s, i, fmt.Sprintf("No MCP server named `%s` is available to you.", name))
 			return
 		}
 		if srv.AuthMode != pb.MCPAuthOAuth {
@@ -306,6 +531,121 @@ func HandleMCPCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
 			s.ChannelMessageSend(channelID, mcpServerStatusLine(serverKey(srv.Owner, srv.Name), name))
 		}()
 
+	case "unlink":
+		name := optStr("name")
+		if name == "" {
+			respondWithMessage(s, i, "`/mcp unlink` requires `name`.")
+			return
+		}
+		srv, err := findVisibleServer(caller, isAdmin, name)
+		if err != nil || srv == nil {
+			respondWithMessage(s, i, fmt.Sprintf("No MCP server named `%s` is available to you.", name))
+			return
+		}
+		key := serverKey(srv.Owner, srv.Name)
+		if err := pb.DeleteUserToken(caller, key); err != nil {
+			respondWithMessage(s, i, "Failed to unlink: "+err.Error())
+			return
+		}
+		setNeedsReauth(key, caller, false)
+		setOAuthLinked(key, caller, false)
+		closeOAuthSessions(key, caller)
+		mcpConnectionsMu.Lock()
+		conn := mcpConnections[key]
+		mcpConnectionsMu.Unlock()
+		if conn != nil && conn.user == caller {
+			disconnectMCPServer(key)
+		}
+		respondWithMessage(s, i, fmt.Sprintf("Unlinked `%s`; your stored authorization was deleted.", name))
+		// Another user's link may still connect it.
+		go syncMCPServers(context.Background())
+
+	case "timeout":
+		name, tool := optStr("name"), optStr("tool")
+		seconds := -1
+		for _, o := range sub.Options {
+			if o.Name == "seconds" {
+				seconds = int(o.IntValue())
+			}
+		}
+		if name == "" || seconds < 0 {
+			respondWithMessage(s, i, "`/mcp timeout` requires `name` and `seconds`.")
+			return
+		}
+		if time.Duration(seconds)*time.Second > maxToolTimeout {
+			respondWithMessage(s, i, fmt.Sprintf("A timeout can be at most %s.", formatDuration(maxToolTimeout)))
+			return
+		}
+		srv, err := pb.GetMCPServer(name, caller)
+		if err != nil || srv == nil {
+			respondWithMessage(s, i, fmt.Sprintf("No MCP server named `%s` that you can manage.", name))
+			return
+		}
+		if tool != "" {
+			mcpConnectionsMu.Lock()
+			conn := mcpConnections[serverKey(srv.Owner, srv.Name)]
+			known := conn == nil || slices.Contains(conn.toolNames, tool)
+			mcpConnectionsMu.Unlock()
+			if !known {
+				respondWithMessage(s, i, fmt.Sprintf("`%s` has no tool named `%s`.", name, tool))
+				return
+			}
+		}
+		if _, err := pb.SetMCPServerTimeout(name, caller, tool, seconds); err != nil {
+			respondWithMessage(s, i, "Failed to update the timeout: "+err.Error())
+			return
+		}
+		target := fmt.Sprintf("`%s` tools", name)
+		if tool != "" {
+			target = fmt.Sprintf("`%s` on `%s`", tool, name)
+		}
+		if seconds == 0 {
+			respondWithMessage(s, i, fmt.Sprintf("Cleared the timeout of %s.", target))
+		} else {
+			respondWithMessage(s, i, fmt.Sprintf("Calls of %s may now run for %s.", target, formatDuration(time.Duration(seconds)*time.Second)))
+		}
+		go syncMCPServers(context.Background())
+
+	case "sampling":
+		name := optStr("name")
+		if name == "" {
+			respondWithMessage(s, i, "`/mcp sampling` requires `name` and `enabled`.")
+			return
+		}
+		var enabled, approval bool
+		var maxTokens, dailyTokens int
+		for _, o := range sub.Options {
+			switch o.Name {
+			case "enabled":
+				enabled = o.BoolValue()
+			case "approval":
+				approval = o.BoolValue()
+			case "max_tokens":
+				maxTokens = int(o.IntValue())
+			case "daily_tokens":
+				dailyTokens = int(o.IntValue())
+			}
+		}
+		if maxTokens > maxSamplingMaxTokens {
+			respondWithMessage(s, i, fmt.Sprintf("`max_tokens` can be at most %d.", maxSamplingMaxTokens))
+			return
+		}
+		found, err := pb.SetMCPServerSampling(name, caller, enabled, maxTokens, dailyTokens, approval)
+		if err != nil {
+			respondWithMessage(s, i, "Failed to update sampling: "+err.Error())
+			return
+		}
+		if !found {
+			respondWithMessage(s, i, fmt.Sprintf("No MCP server named `%s` that you can manage.", name))
+			return
+		}
+		srv, err := pb.GetMCPServer(name, caller)
+		if err != nil || srv == nil {
+			respondWithMessage(s, i, fmt.Sprintf("Updated sampling for `%s`.", name))
+			return
+		}
+		respondWithMessage(s, i, fmt.Sprintf("`%s`: %s.", name, samplingStatus(srv)))
+
 	case "remove":
 		name := optStr("name")
 		if name == "" {
@@ -341,6 +681,23 @@ func HandleMCPCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	case "list":
 		respondWithMessage(s, i, mcpListReport(caller, true))
 
+	case "status":
+		name := optStr("name")
+		if name == "" {
+			respondWithMessage(s, i, "`/mcp status` requires `name`.")
+			return
+		}
+		respondWithMessage(s, i, mcpStatusReport(caller, true, name))
+
+	case "reload":
+		respondWithMessage(s, i, "Re-syncing MCP servers…")
+		channelID := i.ChannelID
+		go func() {
+			resetMCPRetries()
+			syncMCPServers(context.Background())
+			s.ChannelMessageSend(channelID, mcpListReport(caller, true))
+		}()
+
 	default:
 		respondWithMessage(s, i, "Unknown mcp subcommand.")
 	}
@@ -354,7 +711,7 @@ func mcpServerStatusLine(key, name string) string {
 	if conn, ok := mcpConnections[key]; ok {
 		return fmt.Sprintf("✅ Connected `%s` — registered %d tools.", name, len(conn.toolNames))
 	}
-	return fmt.Sprintf("⚠️ `%s` was saved but is not connected (check the URL, token, and reachability). It will be retried automatically.", name)
+	return fmt.Sprintf("⚠️ `%s` was saved but is not connected (check the URL and token, or the command and the bot's log). It will be retried automatically.", name)
 }
 
 // mcpListReport lists the servers the caller can see (their own plus shared ones)
@@ -370,28 +727,22 @@ func mcpListReport(caller string, isAdmin bool) string {
 	var sb strings.Builder
 	shown := 0
 	for _, srv := range servers {
-		visible := srv.Owner == caller ||
-			srv.Visibility == pb.MCPVisibilityPublic ||
-			(srv.Visibility == pb.MCPVisibilityAdmins && isAdmin)
-		if !visible {
+		if !serverVisibleTo(srv, caller, isAdmin) {
 			continue
 		}
-		owner := "you"
-		if srv.Owner != caller {
-			if srv.Owner == "" {
-				owner = "system"
-			} else {
-				owner = srv.Owner
-			}
-		}
+		owner := ownerLabel(srv.Owner, caller)
 		status := "not connected"
 		tools := 0
 		if conn, ok := mcpConnections[serverKey(srv.Owner, srv.Name)]; ok {
 			status, tools = "connected", len(conn.toolNames)
 		} else if !srv.Enabled {
 			status = "disabled"
+		} else if isRestarting(serverKey(srv.Owner, srv.Name)) {
+			status = "restarting"
+		} else if srv.LastError != "" {
+			status = "not connected: " + truncateToLimit(srv.LastError, 100)
 		}
-		sb.WriteString(fmt.Sprintf("• `%s` — %s — owner: %s — %s — %s — %d tools\n", srv.Name, srv.URL, owner, srv.Visibility, status, tools))
+		sb.WriteString(fmt.Sprintf("• `%s` — %s — owner: %s — %s — %s — %d tools\n", srv.Name, serverLocation(srv), owner, srv.Visibility, status, tools))
 		shown++
 	}
 	if shown == 0 {
@@ -400,26 +751,75 @@ func mcpListReport(caller string, isAdmin bool) string {
 	return "**MCP servers:**\n" + sb.String()
 }
 
+// serverVisibleTo reports whether caller may see srv: their own servers, plus
+// shared ones.
+func serverVisibleTo(srv *pb.MCPServer, caller string, isAdmin bool) bool {
+	return srv.Owner == caller ||
+		srv.Visibility == pb.MCPVisibilityPublic ||
+		(srv.Visibility == pb.MCPVisibilityAdmins && isAdmin)
+}
+
+// findVisibleServer returns the server named name that the caller can see,
+// preferring their own when names collide, or nil.
+func findVisibleServer(caller string, isAdmin bool, name string) (*pb.MCPServer, error) {
+	servers, err := pb.ListMCPServers()
+	if err != nil {
+		return nil, err
+	}
+	var srv *pb.MCPServer
+	for _, cand := range servers {
+		if !strings.EqualFold(cand.Name, name) || !serverVisibleTo(cand, caller, isAdmin) {
+			continue
+		}
+		if srv == nil || cand.Owner == caller {
+			srv = cand
+		}
+	}
+	return srv, nil
+}
+
+// ownerLabel names a server's owner relative to caller.
+func ownerLabel(owner, caller string) string {
+	switch owner {
+	case caller:
+		return "you"
+	case "":
+		return "system"
+	default:
+		return owner
+	}
+}
+
 // callMCPTool invokes a remote MCP tool and renders its result as a string for
 // the model, preferring the human-readable text content the server returns and
-// falling back to its structured JSON payload.
+// falling back to its structured JSON payload. Images and files are attached to
+// the reply (see tool_attachments.go) and referenced in the text.
 func callMCPTool(ctx context.Context, session *mcp.ClientSession, name string, args map[string]any) (string, error) {
 	if session == nil {
 		return "", fmt.Errorf("MCP server is not connected")
 	}
-	res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: name, Arguments: args})
+	params := &mcp.CallToolParams{Name: name, Arguments: args}
+	defer watchProgress(ctx, params)()
+	res, err := session.CallTool(ctx, params)
 	if err != nil {
 		return "", err
 	}
 
 	var sb strings.Builder
 	for _, c := range res.Content {
+		var part string
 		if tc, ok := c.(*mcp.TextContent); ok {
-			if sb.Len() > 0 {
-				sb.WriteString("\n")
-			}
-			sb.WriteString(tc.Text)
+			part = tc.Text
+		} else {
+			part = forwardMCPContent(ctx, name, c)
+		}
+		if part == "" {
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
 		}
+		sb.WriteString(part)
 	}
 	text := sb.String()
 	if text == "" && res.StructuredContent != nil {
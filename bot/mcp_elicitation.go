@@ -0,0 +1,543 @@
+package bot
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/charmbracelet/log"
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// MCP servers can ask for more input in the middle of a tool call
+// (elicitation). The request is put to the user who made the call, in the
+// channel it came from: a yes/no or pick-one question becomes buttons, a form
+// becomes a modal built from the requested schema, and a URL request shows the
+// link once they agree to open it. Their answer, a decline, or a cancel when
+// they don't answer in time goes back to the server.
+//
+// Elicitation requests don't say which call they belong to, so they go to the
+// caller only when every call in flight on that session is theirs; otherwise
+// (or with no call in flight) the request is cancelled.
+
+const (
+	elicitationTimeout = 5 * time.Minute
+	// maxElicitationFields is Discord's limit of text inputs per modal.
+	maxElicitationFields = 5
+	// maxElicitationChoices is how many options are offered as buttons.
+	maxElicitationChoices = 4
+)
+
+// mcpCall is a tool call in flight on a session.
+type mcpCall struct {
+	ctx       context.Context
+	server    string
+	tool      string
+	userID    string
+	channelID string
+}
+
+var (
+	mcpCalls   = map[*mcp.ClientSession][]*mcpCall{}
+	mcpCallsMu sync.Mutex
+)
+
+// trackMCPCall records a call in flight until the returned func is called.
+func trackMCPCall(session *mcp.ClientSession, call *mcpCall) func() {
+	mcpCallsMu.Lock()
+	mcpCalls[session] = append(mcpCalls[session], call)
+	mcpCallsMu.Unlock()
+	return func() {
+		mcpCallsMu.Lock()
+		defer mcpCallsMu.Unlock()
+		calls := mcpCalls[session]
+		for i, c := range calls {
+			if c == call {
+				calls = append(calls[:i:i], calls[i+1:]...)
+				break
+			}
+		}
+		if len(calls) == 0 {
+			delete(mcpCalls, session)
+		} else {
+			mcpCalls[session] = calls
+		}
+	}
+}
+
+// elicitingCall returns the latest call in flight on session if all of them
+// are by the same user, or nil.
+func elicitingCall(session *mcp.ClientSession) *mcpCall {
+	mcpCallsMu.Lock()
+	defer mcpCallsMu.Unlock()
+	calls := mcpCalls[session]
+	if len(calls) == 0 {
+		return nil
+	}
+	for _, c := range calls {
+		if c.userID != calls[0].userID {
+			return nil
+		}
+	}
+	return calls[len(calls)-1]
+}
+
+// elicitField is one property of a requested form.
+type elicitField struct {
+	name        string
+	title       string
+	description string
+	kind        string   // the JSON Schema type: string, number, integer, boolean, object or array
+	enum        []string // as shown
+	enumValues  []any    // as sent back
+	required    bool
+	def         string
+	maxLength   int
+}
+
+// elicitation is a question waiting for the user's answer.
+type elicitation struct {
+	id        string
+	call      *mcpCall
+	params    *mcp.ElicitParams
+	schema    map[string]any
+	fields    []elicitField
+	result    chan *mcp.ElicitResult
+	deadline  time.Time
+	messageID string
+}
+
+var (
+	elicitations   = map[string]*elicitation{}
+	elicitationsMu sync.Mutex
+)
+
+func lookupElicitation(id string) *elicitation {
+	elicitationsMu.Lock()
+	defer elicitationsMu.Unlock()
+	return elicitations[id]
+}
+
+// answer delivers the user's answer; only the first one counts.
+func (e *elicitation) answer(res *mcp.ElicitResult) {
+	select {
+	case e.result <- res:
+	default:
+	}
+}
+
+// handleElicitation is the MCP client's elicitation handler.
+func handleElicitation(ctx context.Context, req *mcp.ElicitRequest) (*mcp.ElicitResult, error) {
+	cancelled := &mcp.ElicitResult{Action: "cancel"}
+	call := elicitingCall(req.Session)
+	s := botSession.Load()
+	if call == nil || s == nil {
+		log.Warnf("Cancelled an MCP elicitation with no single caller to ask: %q", req.Params.Message)
+		return cancelled, nil
+	}
+
+	e := &elicitation{id: newPromptID(), call: call, params: req.Params, result: make(chan *mcp.ElicitResult, 1)}
+	// The answer is only of use while the call waits for it.
+	e.deadline = time.Now().Add(elicitationTimeout)
+	if d, ok := call.ctx.Deadline(); ok && d.Before(e.deadline) {
+		e.deadline = d
+	}
+	if req.Params.Mode != "url" {
+		e.schema = schemaMap(req.Params.RequestedSchema)
+		e.fields = elicitFields(e.schema)
+		if len(e.fields) > maxElicitationFields {
+			s.ChannelMessageSend(call.channelID, fmt.Sprintf("⚠️ `%s` asked <@%s> for %d fields of input, more than a Discord form can hold; the request was cancelled.", call.server, call.userID, len(e.fields)))
+			return cancelled, nil
+		}
+	}
+
+	msg, err := s.ChannelMessageSendComplex(call.channelID, &discordgo.MessageSend{
+		Content:         elicitationText(e, ""),
+		Components:      elicitationComponents(e, false),
+		AllowedMentions: &discordgo.MessageAllowedMentions{Users: []string{call.userID}},
+	})
+	if err != nil {
+		log.Errorf("Failed to post MCP elicitation: %v", err)
+		return cancelled, nil
+	}
+	e.messageID = msg.ID
+	elicitationsMu.Lock()
+	elicitations[e.id] = e
+	elicitationsMu.Unlock()
+	defer func() {
+		elicitationsMu.Lock()
+		delete(elicitations, e.id)
+		elicitationsMu.Unlock()
+	}()
+
+	timer := time.NewTimer(time.Until(e.deadline))
+	defer timer.Stop()
+	var res *mcp.ElicitResult
+	outcome := ""
+	select {
+	case res = <-e.result:
+		switch res.Action {
+		case "accept":
+			outcome = "✅ Answered."
+		default:
+			outcome = "🚫 Declined."
+		}
+	case <-timer.C:
+		res, outcome = cancelled, "⌛ No answer in time; cancelled."
+	case <-ctx.Done():
+		res, outcome = cancelled, "Cancelled by the server."
+	case <-call.ctx.Done():
+		res, outcome = cancelled, "⌛ The tool call ended before an answer; cancelled."
+	}
+
+	content := elicitationText(e, outcome)
+	components := elicitationComponents(e, true)
+	if _, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		Channel:    call.channelID,
+		ID:         e.messageID,
+		Content:    &content,
+		Components: &components,
+	}); err != nil {
+		log.Warnf("Failed to update MCP elicitation message: %v", err)
+	}
+	return res, nil
+}
+
+// newPromptID identifies a prompt waiting for a button or modal.
+func newPromptID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// elicitFields reads the properties of a requested schema, in a stable order:
+// required ones first, then by name.
+func elicitFields(schema map[string]any) []elicitField {
+	props, _ := schema["properties"].(map[string]any)
+	required := map[string]bool{}
+	if req, ok := schema["required"].([]any); ok {
+		for _, r := range req {
+			if name, ok := r.(string); ok {
+				required[name] = true
+			}
+		}
+	}
+	fields := make([]elicitField, 0, len(props))
+	for name, p := range props {
+		prop, _ := p.(map[string]any)
+		f := elicitField{name: name, title: name, kind: "string", required: required[name]}
+		if t, ok := prop["title"].(string); ok && t != "" {
+			f.title = t
+		}
+		f.description, _ = prop["description"].(string)
+		if t, ok := prop["type"].(string); ok {
+			f.kind = t
+		}
+		if enum, ok := prop["enum"].([]any); ok {
+			for _, v := range enum {
+				f.enum = append(f.enum, fmt.Sprint(v))
+			}
+			f.enumValues = enum
+		}
+		if d, ok := prop["default"]; ok && d != nil {
+			f.def = fmt.Sprint(d)
+		}
+		if n, ok := prop["maxLength"].(float64); ok {
+			f.maxLength = int(n)
+		}
+		fields = append(fields, f)
+	}
+	sort.Slice(fields, func(a, b int) bool {
+		if fields[a].required != fields[b].required {
+			return fields[a].required
+		}
+		return fields[a].name < fields[b].name
+	})
+	return fields
+}
+
+// choices returns the options to offer as buttons when the form is a single
+// yes/no or pick-one question, or nil.
+func (e *elicitation) choices() []string {
+	if len(e.fields) != 1 {
+		return nil
+	}
+	f := e.fields[0]
+	switch {
+	case f.kind == "boolean":
+		return []string{"Yes", "No"}
+	case len(f.enum) > 0 && len(f.enum) <= maxElicitationChoices:
+		return f.enum
+	}
+	return nil
+}
+
+func elicitationText(e *elicitation, outcome string) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("❓ <@%s>, the MCP server `%s` needs your input for `%s`:\n", e.call.userID, e.call.server, e.call.tool))
+	sb.WriteString(">>> " + truncateToLimit(e.params.Message, 1500) + "\n")
+	if e.params.Mode == "url" {
+		if u, err := url.Parse(e.params.URL); err == nil && u.Host != "" {
+			sb.WriteString(fmt.Sprintf("It wants you to open a link on **%s**.\n", u.Host))
+		}
+	} else if e.choices() == nil {
+		for _, f := range e.fields {
+			line := "• **" + f.title + "**"
+			if !f.required {
+				line += " (optional)"
+			}
+			if f.description != "" {
+				line += " — " + f.description
+			}
+			sb.WriteString(truncateToLimit(line, 200) + "\n")
+		}
+	}
+	if outcome != "" {
+		sb.WriteString(outcome)
+	} else {
+		sb.WriteString(fmt.Sprintf("Expires <t:%d:R>.", e.deadline.Unix()))
+	}
+	return truncateToLimit(sb.String(), discordMessageLimit)
+}
+
+func elicitationComponents(e *elicitation, disabled bool) []discordgo.MessageComponent {
+	decline := discordgo.Button{Label: "Decline", Style: discordgo.SecondaryButton, CustomID: "elicit_decline_" + e.id, Disabled: disabled}
+	var buttons []discordgo.MessageComponent
+	switch choices := e.choices(); {
+	case e.params.Mode == "url":
+		buttons = append(buttons, discordgo.Button{Label: "Open link", Style: discordgo.PrimaryButton, CustomID: "elicit_open_" + e.id, Disabled: disabled})
+	case choices != nil:
+		for n, c := range choices {
+			buttons = append(buttons, discordgo.Button{Label: truncateToLimit(c, 80), Style: discordgo.PrimaryButton, CustomID: fmt.Sprintf("elicit_choice_%s_%d", e.id, n), Disabled: disabled})
+		}
+	case len(e.fields) == 0:
+		buttons = append(buttons, discordgo.Button{Label: "Accept", Style: discordgo.SuccessButton, CustomID: "elicit_accept_" + e.id, Disabled: disabled})
+	default:
+		buttons = append(buttons, discordgo.Button{Label: "Respond", Style: discordgo.PrimaryButton, CustomID: "elicit_respond_" + e.id, Disabled: disabled})
+	}
+	buttons = append(buttons, decline)
+	return []discordgo.MessageComponent{discordgo.ActionsRow{Components: buttons}}
+}
+
+// handleElicitationButton handles the buttons of an elicitation prompt. It
+// reports whether the interaction was one.
+func handleElicitationButton(s *discordgo.Session, i *discordgo.InteractionCreate) bool {
+	customID := i.MessageComponentData().CustomID
+	if !strings.HasPrefix(customID, "elicit_") {
+		return false
+	}
+	action, rest, ok := strings.Cut(strings.TrimPrefix(customID, "elicit_"), "_")
+	if !ok {
+		return false
+	}
+	id, choice, _ := strings.Cut(rest, "_")
+	e := lookupElicitation(id)
+	if e == nil {
+		respondWithMessage(s, i, "This request is no longer waiting for an answer.")
+		return true
+	}
+	if getUserID(i) != e.call.userID {
+		respondWithMessage(s, i, fmt.Sprintf("Only <@%s> can answer this.", e.call.userID))
+		return true
+	}
+
+	switch action {
+	case "decline":
+		e.answer(&mcp.ElicitResult{Action: "decline"})
+	case "accept":
+		e.answer(&mcp.ElicitResult{Action: "accept", Content: map[string]any{}})
+	case "open":
+		e.answer(&mcp.ElicitResult{Action: "accept"})
+		respondWithMessage(s, i, "Open this link to continue: "+e.params.URL)
+		return true
+	case "choice":
+		n, err := strconv.Atoi(choice)
+		choices := e.choices()
+		if err != nil || n < 0 || n >= len(choices) {
+			respondWithMessage(s, i, "Unknown choice.")
+			return true
+		}
+		f := e.fields[0]
+		var value any = n == 0 // Yes/No
+		if f.kind != "boolean" {
+			value = f.enumValues[n]
+		}
+		e.answer(&mcp.ElicitResult{Action: "accept", Content: map[string]any{f.name: value}})
+	case "respond":
+		if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseModal,
+			Data: &discordgo.InteractionResponseData{
+				CustomID:   "elicit_modal_" + e.id,
+				Title:      truncateToLimit(e.call.server+" needs your input", 45),
+				Components: elicitationModalFields(e.fields),
+			},
+		}); err != nil {
+			log.Errorf("Failed to open MCP elicitation form: %v", err)
+		}
+		return true
+	default:
+		return false
+	}
+	// The waiting handler updates the message.
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseDeferredMessageUpdate})
+	return true
+}
+
+// elicitationModalFields builds a modal's text inputs, one per field.
+func elicitationModalFields(fields []elicitField) []discordgo.MessageComponent {
+	rows := make([]discordgo.MessageComponent, 0, len(fields))
+	for _, f := range fields {
+		input := discordgo.TextInput{
+			CustomID:  f.name,
+			Label:     truncateToLimit(f.title, 45),
+			Style:     discordgo.TextInputShort,
+			Required:  f.required,
+			Value:     f.def,
+			MaxLength: min(f.maxLength, 4000),
+		}
+		placeholder := f.description
+		switch {
+		case len(f.enum) > 0:
+			placeholder = "One of: " + strings.Join(f.enum, ", ")
+		case f.kind == "boolean":
+			placeholder = "yes or no"
+		case f.kind == "integer" || f.kind == "number":
+			placeholder = strings.TrimSpace("A number. " + f.description)
+		case f.maxLength == 0 || f.maxLength > 200:
+			input.Style = discordgo.TextInputParagraph
+		}
+		input.Placeholder = truncateToLimit(placeholder, 100)
+		rows = append(rows, discordgo.ActionsRow{Components: []discordgo.MessageComponent{input}})
+	}
+	return rows
+}
+
+// handleElicitationModal handles a submitted elicitation form. It reports
+// whether the interaction was one.
+func handleElicitationModal(s *discordgo.Session, i *discordgo.InteractionCreate) bool {
+	data := i.ModalSubmitData()
+	if !strings.HasPrefix(data.CustomID, "elicit_modal_") {
+		return false
+	}
+	e := lookupElicitation(strings.TrimPrefix(data.CustomID, "elicit_modal_"))
+	if e == nil {
+		respondWithMessage(s, i, "This request is no longer waiting for an answer.")
+		return true
+	}
+	if getUserID(i) != e.call.userID {
+		respondWithMessage(s, i, fmt.Sprintf("Only <@%s> can answer this.", e.call.userID))
+		return true
+	}
+
+	values := modalValues(data)
+	content := map[string]any{}
+	var problems []string
+	for _, f := range e.fields {
+		raw := values[f.name]
+		if raw == "" {
+			continue // required fields are enforced by the modal
+		}
+		v, err := parseElicitValue(f, raw)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("**%s**: %v", f.title, err))
+			continue
+		}
+		content[f.name] = v
+	}
+	if len(problems) == 0 {
+		if err := checkElicitContent(e.schema, content); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		respondWithMessage(s, i, "⚠️ "+strings.Join(problems, "\n")+"\nPress **Respond** to try again.")
+		return true
+	}
+	e.answer(&mcp.ElicitResult{Action: "accept", Content: content})
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseDeferredMessageUpdate})
+	return true
+}
+
+// modalValues returns a submitted modal's text inputs by ID, trimmed.
+func modalValues(data discordgo.ModalSubmitInteractionData) map[string]string {
+	values := map[string]string{}
+	for _, row := range data.Components {
+		r, ok := row.(*discordgo.ActionsRow)
+		if !ok {
+			continue
+		}
+		for _, c := range r.Components {
+			if input, ok := c.(*discordgo.TextInput); ok {
+				values[input.CustomID] = strings.TrimSpace(input.Value)
+			}
+		}
+	}
+	return values
+}
+
+// checkElicitContent validates an answer the way the MCP client will before
+// sending it, so the user can correct it rather than the server getting an
+// error.
+func checkElicitContent(schema map[string]any, content map[string]any) error {
+	if schema == nil {
+		return nil
+	}
+	b, err := json.Marshal(schema)
+	if err != nil {
+		return nil
+	}
+	var js jsonschema.Schema
+	if err := json.Unmarshal(b, &js); err != nil {
+		return nil
+	}
+	resolved, err := js.Resolve(nil)
+	if err != nil {
+		return nil // the client reports a broken schema to the server
+	}
+	return resolved.Validate(content)
+}
+
+// parseElicitValue converts a typed answer to the field's type.
+func parseElicitValue(f elicitField, raw string) (any, error) {
+	if len(f.enum) > 0 {
+		for n, v := range f.enum {
+			if strings.EqualFold(v, raw) {
+				return f.enumValues[n], nil
+			}
+		}
+		return nil, fmt.Errorf("must be one of %s", strings.Join(f.enum, ", "))
+	}
+	switch f.kind {
+	case "boolean":
+		switch strings.ToLower(raw) {
+		case "yes", "y", "true", "1":
+			return true, nil
+		case "no", "n", "false", "0":
+			return false, nil
+		}
+		return nil, fmt.Errorf("answer yes or no")
+	case "integer":
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be a whole number")
+		}
+		return float64(n), nil // as JSON would decode it
+	case "number":
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be a number")
+		}
+		return n, nil
+	}
+	return raw, nil
+}
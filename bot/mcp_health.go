@@ -0,0 +1,274 @@
+package bot
+
+import (
+	"bitbot/pb"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Live connections are pinged on every reconcile. A server that misses
+// mcpMaxPingFailures pings in a row is disconnected (its tools are removed) and,
+// like a server that fails to connect, retried with exponential backoff. The
+// last error, last connect time and ping latency are stored on the server's
+// mcp_servers row for /mcp list and /mcp status.
+
+const (
+	mcpPingTimeout        = 10 * time.Second
+	mcpMaxPingFailures    = 2
+	mcpRetryMinBackoff    = 30 * time.Second
+	mcpRetryMaxBackoff    = 30 * time.Minute
+	maxStatusInstructions = 1000
+)
+
+// mcpRetryState tracks a server that failed to connect.
+type mcpRetryState struct {
+	failures int
+	next     time.Time
+}
+
+var (
+	mcpRetries   = map[string]*mcpRetryState{} // keyed by serverKey
+	mcpRetriesMu sync.Mutex
+)
+
+// retryDue reports whether a server that failed before may be retried now.
+func retryDue(key string) bool {
+	mcpRetriesMu.Lock()
+	defer mcpRetriesMu.Unlock()
+	st := mcpRetries[key]
+	return st == nil || !time.Now().Before(st.next)
+}
+
+// nextRetry returns when a failed server will be retried, or zero.
+func nextRetry(key string) time.Time {
+	mcpRetriesMu.Lock()
+	defer mcpRetriesMu.Unlock()
+	if st := mcpRetries[key]; st != nil {
+		return st.next
+	}
+	return time.Time{}
+}
+
+// noteMCPFailure records a failed connect (or a dropped connection) and
+// schedules the next attempt.
+func noteMCPFailure(srvID, key, name string, err error) {
+	mcpRetriesMu.Lock()
+	st := mcpRetries[key]
+	if st == nil {
+		st = &mcpRetryState{}
+		mcpRetries[key] = st
+	}
+	st.failures++
+	delay := mcpRetryMaxBackoff
+	if st.failures <= 16 {
+		delay = min(mcpRetryMinBackoff<<(st.failures-1), mcpRetryMaxBackoff)
+	}
+	st.next = time.Now().Add(delay)
+	mcpRetriesMu.Unlock()
+
+	log.Warnf("MCP server %q: %v; retrying in %s", name, err, delay)
+	if perr := pb.RecordMCPServerError(srvID, err.Error()); perr != nil {
+		log.Warnf("Failed to record MCP server error: %v", perr)
+	}
+}
+
+// noteMCPConnected clears a server's backoff and records the connection.
+func noteMCPConnected(conn *mcpConnection) {
+	mcpRetriesMu.Lock()
+	delete(mcpRetries, conn.key)
+	mcpRetriesMu.Unlock()
+	if err := pb.RecordMCPServerConnected(conn.id); err != nil {
+		log.Warnf("Failed to record MCP server connection: %v", err)
+	}
+	pingMCPConnection(conn)
+}
+
+// resetMCPRetries lets every failed server be retried right away.
+func resetMCPRetries() {
+	mcpRetriesMu.Lock()
+	defer mcpRetriesMu.Unlock()
+	mcpRetries = map[string]*mcpRetryState{}
+}
+
+// checkMCPHealth pings every live connection.
+func checkMCPHealth() {
+	mcpConnectionsMu.Lock()
+	conns := make([]*mcpConnection, 0, len(mcpConnections))
+	for _, conn := range mcpConnections {
+		conns = append(conns, conn)
+	}
+	mcpConnectionsMu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pingMCPConnection(conn)
+		}()
+	}
+	wg.Wait()
+}
+
+// pingMCPConnection pings one server and records the latency, disconnecting it
+// once it has missed too many pings in a row.
+func pingMCPConnection(conn *mcpConnection) {
+	ctx, cancel := context.WithTimeout(context.Background(), mcpPingTimeout)
+	defer cancel()
+	start := time.Now()
+	err := conn.session.Ping(ctx, nil)
+	latency := time.Since(start)
+
+	mcpConnectionsMu.Lock()
+	if err == nil {
+		conn.pingFailures = 0
+		conn.latency = latency
+	} else {
+		conn.pingFailures++
+	}
+	failures := conn.pingFailures
+	mcpConnectionsMu.Unlock()
+
+	if err == nil {
+		if perr := pb.RecordMCPServerLatency(conn.id, latency); perr != nil {
+			log.Warnf("Failed to record MCP server latency: %v", perr)
+		}
+		return
+	}
+	if failures < mcpMaxPingFailures {
+		log.Warnf("MCP server %q owner=%q missed a ping: %v", conn.name, conn.owner, err)
+		return
+	}
+	if !isCurrentSession(conn.key, conn.session) {
+		return
+	}
+	disconnectMCPServer(conn.key)
+	if errors.Is(err, errOAuthReauth) {
+		// The user was asked to link again; see requestReauth.
+		return
+	}
+	noteMCPFailure(conn.id, conn.key, conn.name, fmt.Errorf("connection lost: %w", err))
+}
+
+// capabilityNames lists what a server offers, for /mcp status.
+func capabilityNames(caps *mcp.ServerCapabilities) []string {
+	if caps == nil {
+		return nil
+	}
+	var names []string
+	listChanged := func(name string, changed bool) string {
+		if changed {
+			return name + " (list changes)"
+		}
+		return name
+	}
+	if caps.Tools != nil {
+		names = append(names, listChanged("tools", caps.Tools.ListChanged))
+	}
+	if caps.Resources != nil {
+		name := listChanged("resources", caps.Resources.ListChanged)
+		if caps.Resources.Subscribe {
+			name += " (subscribe)"
+		}
+		names = append(names, name)
+	}
+	if caps.Prompts != nil {
+		names = append(names, listChanged("prompts", caps.Prompts.ListChanged))
+	}
+	if caps.Logging != nil {
+		names = append(names, "logging")
+	}
+	if caps.Completions != nil {
+		names = append(names, "completions")
+	}
+	var experimental []string
+	for name := range caps.Experimental {
+		experimental = append(experimental, "experimental: "+name)
+	}
+	sort.Strings(experimental)
+	return append(names, experimental...)
+}
+
+// mcpStatusReport describes one server the caller can see, preferring their
+// own when names collide.
+func mcpStatusReport(caller string, isAdmin bool, name string) string {
+	srv, err := findVisibleServer(caller, isAdmin, name)
+	if err != nil {
+		return "Failed to list MCP servers: " + err.Error()
+	}
+	if srv == nil {
+		return fmt.Sprintf("No MCP server named `%s` is available to you.", name)
+	}
+	key := serverKey(srv.Owner, srv.Name)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("**MCP server `%s`**\n", srv.Name))
+	sb.WriteString(fmt.Sprintf("Location: %s\n", serverLocation(srv)))
+	sb.WriteString(fmt.Sprintf("Owner: %s — visibility: %s — auth: %s\n", ownerLabel(srv.Owner, caller), srv.Visibility, srv.AuthMode))
+
+	mcpConnectionsMu.Lock()
+	conn := mcpConnections[key]
+	var init *mcp.InitializeResult
+	var tools int
+	var latency time.Duration
+	if conn != nil {
+		init, tools, latency = conn.session.InitializeResult(), len(conn.toolNames), conn.latency
+	}
+	mcpConnectionsMu.Unlock()
+
+	switch {
+	case conn != nil:
+		sb.WriteString(fmt.Sprintf("Status: connected — %d tools", tools))
+		if latency > 0 {
+			sb.WriteString(fmt.Sprintf(" — ping %d ms", latency.Milliseconds()))
+		}
+		sb.WriteString("\n")
+	case !srv.Enabled:
+		sb.WriteString("Status: disabled\n")
+	case isRestarting(key):
+		sb.WriteString("Status: restarting\n")
+	default:
+		status := "Status: not connected"
+		if next := nextRetry(key); !next.IsZero() {
+			status += fmt.Sprintf(" — next attempt <t:%d:R>", next.Unix())
+		}
+		sb.WriteString(status + "\n")
+	}
+	if !srv.LastConnectedAt.IsZero() {
+		sb.WriteString(fmt.Sprintf("Last connected: <t:%d:f>\n", srv.LastConnectedAt.Unix()))
+	}
+	sb.WriteString(timeoutStatus(srv) + "\n")
+	sb.WriteString(samplingStatus(srv) + "\n")
+	if srv.AuthMode == pb.MCPAuthOAuth {
+		if isOAuthLinked(key, caller) {
+			sb.WriteString("Your account: linked\n")
+		} else {
+			sb.WriteString(fmt.Sprintf("Your account: not linked — run `/mcp link name:%s` to use its tools\n", srv.Name))
+		}
+	}
+	if srv.LastError != "" {
+		sb.WriteString(fmt.Sprintf("Last error (<t:%d:R>): %s\n", srv.LastErrorAt.Unix(), truncateToLimit(srv.LastError, 300)))
+	}
+
+	if init != nil {
+		if init.ServerInfo != nil {
+			sb.WriteString(fmt.Sprintf("Server: %s %s\n", init.ServerInfo.Name, init.ServerInfo.Version))
+		}
+		sb.WriteString(fmt.Sprintf("Protocol version: %s\n", init.ProtocolVersion))
+		if caps := capabilityNames(init.Capabilities); len(caps) > 0 {
+			sb.WriteString("Capabilities: " + strings.Join(caps, ", ") + "\n")
+		}
+		if init.Instructions != "" {
+			sb.WriteString("Instructions:\n>>> " + truncateToLimit(init.Instructions, maxStatusInstructions) + "\n")
+		}
+	}
+	return truncateToLimit(sb.String(), discordMessageLimit)
+}
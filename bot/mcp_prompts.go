@@ -0,0 +1,235 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/charmbracelet/log"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// MCP prompts are run with /prompt: the name option autocompletes from the
+// prompts of the connected servers the caller may use, and running one fetches
+// the prompt (with the given arguments) and expands it into a normal chat turn
+// for the caller, as if they had typed it.
+
+// maxCachedPrompts caps how many prompts are cached per server.
+const maxCachedPrompts = 200
+
+// listServerPrompts fetches a server's prompts for autocomplete.
+func listServerPrompts(session *mcp.ClientSession) []*mcp.Prompt {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	var prompts []*mcp.Prompt
+	for p, err := range session.Prompts(ctx, nil) {
+		if err != nil {
+			log.Warnf("Failed to list MCP prompts: %v", err)
+			break
+		}
+		if len(prompts) >= maxCachedPrompts {
+			break
+		}
+		prompts = append(prompts, p)
+	}
+	return prompts
+}
+
+func hasPrompts(caps *mcp.ServerCapabilities) bool { return caps.Prompts != nil }
+
+// promptsOf returns a connection's cached prompts, which change when the
+// server announces new ones.
+func promptsOf(conn *mcpConnection) []*mcp.Prompt {
+	mcpConnectionsMu.Lock()
+	defer mcpConnectionsMu.Unlock()
+	return conn.prompts
+}
+
+// promptChoiceValue identifies a prompt in an autocomplete choice.
+func promptChoiceValue(conn *mcpConnection, prompt string) string {
+	return conn.key + "|" + prompt
+}
+
+// HandlePromptAutocomplete suggests prompts matching what the caller typed.
+func HandlePromptAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	typed := ""
+	for _, o := range i.ApplicationCommandData().Options {
+		if o.Name == "name" && o.Focused {
+			typed = strings.ToLower(o.StringValue())
+		}
+	}
+	c := newToolCaller(s, getUserID(i), i.ChannelID, i.GuildID)
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, conn := range accessibleConnections(c, "prompt", "", hasPrompts) {
+		for _, p := range promptsOf(conn) {
+			label := p.Name
+			if p.Title != "" {
+				label = p.Title
+			}
+			label = fmt.Sprintf("%s (%s)", label, conn.name)
+			if p.Description != "" {
+				label += " — " + p.Description
+			}
+			if typed != "" && !strings.Contains(strings.ToLower(label), typed) {
+				continue
+			}
+			value := promptChoiceValue(conn, p.Name)
+			if len(value) > 100 {
+				continue // Discord's limit for choice values
+			}
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: truncateToLimit(label, 100), Value: value})
+		}
+	}
+	sort.Slice(choices, func(a, b int) bool { return choices[a].Name < choices[b].Name })
+	if len(choices) > 25 {
+		choices = choices[:25]
+	}
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
+	}); err != nil {
+		log.Warnf("Failed to answer /prompt autocomplete: %v", err)
+	}
+}
+
+// HandlePromptCommand handles /prompt name:<prompt> [arguments:<k=v; ...>].
+func HandlePromptCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	var value, rawArgs string
+	for _, o := range i.ApplicationCommandData().Options {
+		switch o.Name {
+		case "name":
+			value = o.StringValue()
+		case "arguments":
+			rawArgs = o.StringValue()
+		}
+	}
+	userID := getUserID(i)
+	c := newToolCaller(s, userID, i.ChannelID, i.GuildID)
+
+	key, name, ok := strings.Cut(value, "|")
+	var conn *mcpConnection
+	var prompt *mcp.Prompt
+	if ok {
+		for _, cand := range accessibleConnections(c, "prompt", "", hasPrompts) {
+			if cand.key != key {
+				continue
+			}
+			for _, p := range promptsOf(cand) {
+				if p.Name == name {
+					conn, prompt = cand, p
+				}
+			}
+		}
+	}
+	if prompt == nil {
+		respondWithMessage(s, i, "Pick a prompt from the suggestions (prompts from the MCP servers available to you).")
+		return
+	}
+
+	args, err := parseKeyValues(rawArgs)
+	if err != nil {
+		respondWithMessage(s, i, "⚠️ "+err.Error())
+		return
+	}
+	var missing []string
+	for _, a := range prompt.Arguments {
+		if a.Required && args[a.Name] == "" {
+			missing = append(missing, "`"+a.Name+"`")
+		}
+	}
+	if len(missing) > 0 {
+		respondWithMessage(s, i, fmt.Sprintf("The `%s` prompt needs %s. Pass them as `arguments: name=value; other=value`.", prompt.Name, strings.Join(missing, ", ")))
+		return
+	}
+
+	// Fetching the prompt may take longer than Discord allows for a reply,
+	// so acknowledge first.
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content:         fmt.Sprintf("📝 <@%s> ran the `%s` prompt from `%s`.", userID, prompt.Name, conn.name),
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		},
+	}); err != nil {
+		log.Warnf("Failed to acknowledge /prompt: %v", err)
+	}
+	go runMCPPrompt(s, conn, prompt.Name, args, userID, i.ChannelID, i.GuildID)
+}
+
+// runMCPPrompt fetches a prompt and runs it as a chat turn for userID.
+func runMCPPrompt(s *discordgo.Session, conn *mcpConnection, name string, args map[string]string, userID, channelID, guildID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	session, err := sessionFor(ctx, conn, userID)
+	if err != nil {
+		s.ChannelMessageSend(channelID, fmt.Sprintf("⚠️ Could not get the `%s` prompt: %v", name, err))
+		return
+	}
+	res, err := session.GetPrompt(ctx, &mcp.GetPromptParams{Name: name, Arguments: args})
+	if err != nil {
+		s.ChannelMessageSend(channelID, fmt.Sprintf("⚠️ Could not get the `%s` prompt: %v", name, err))
+		return
+	}
+	text := promptText(res)
+	if text == "" {
+		s.ChannelMessageSend(channelID, fmt.Sprintf("⚠️ The `%s` prompt is empty.", name))
+		return
+	}
+	displayName := lookupDisplayName(s, guildID, userID) + " (prompt " + name + ")"
+	// The text of a server the caller doesn't own could steer the turn, so it
+	// is attributed to that server rather than to the caller.
+	author := userID
+	if conn.owner != userID {
+		author = "mcp:" + conn.key
+	}
+	getConversation(channelID).appendPrompt(userID, displayName, text, author)
+	chatbot(s, userID, channelID, guildID)
+}
+
+// parseKeyValues parses "name=value; other=value", as used for prompt
+// arguments and command server environments.
+func parseKeyValues(raw string) (map[string]string, error) {
+	args := map[string]string{}
+	for _, part := range strings.Split(raw, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(part, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("invalid argument %q: use `name=value; other=value`", strings.TrimSpace(part))
+		}
+		args[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return args, nil
+}
+
+// promptText flattens a prompt's messages into the text of one chat message.
+// Messages in the assistant role are labelled, as the turn is sent as the
+// caller's message.
+func promptText(res *mcp.GetPromptResult) string {
+	var parts []string
+	for _, m := range res.Messages {
+		var text string
+		switch c := m.Content.(type) {
+		case *mcp.TextContent:
+			text = c.Text
+		case *mcp.EmbeddedResource:
+			if c.Resource != nil && c.Resource.Text != "" {
+				text = fmt.Sprintf("[resource %s]\n%s", c.Resource.URI, c.Resource.Text)
+			}
+		case *mcp.ResourceLink:
+			text = fmt.Sprintf("[resource %s]", c.URI)
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		if m.Role == "assistant" {
+			text = "(assistant) " + text
+		}
+		parts = append(parts, text)
+	}
+	return strings.Join(parts, "\n\n")
+}
@@ -0,0 +1,193 @@
+package bot
+
+import (
+	"bitbot/pb"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// MCP resources are reached through two local toolbelt tools, list_resources
+// and read_resource, that take a server name. A server's resources are
+// available to exactly the callers who may use its tools: the owner, then its
+// visibility, refined by tool policies (a policy on the server, or on
+// list_resources/read_resource, applies).
+
+// maxListedResources caps how many resources list_resources returns per server.
+const maxListedResources = 100
+
+// serverAccessTool stands in for a server's resource tool in access checks, so
+// the server's owner, visibility and policies apply.
+func serverAccessTool(conn *mcpConnection, toolName string) *registeredTool {
+	return &registeredTool{Name: toolName, Source: conn.key, Owner: conn.owner, Visibility: conn.visibility}
+}
+
+// accessibleConnections returns the live connections the caller may use for
+// toolName whose capabilities satisfy has. Access follows the same rules as the
+// server's tools, with toolName as the tool: list_resources or read_resource,
+// or the pseudo tool name "prompt", which lets a policy target prompts
+// specifically. A non-empty server limits them to that server name, preferring
+// the caller's own server when names collide. OAuth servers count only once the
+// caller has linked them.
+func accessibleConnections(c toolCaller, toolName, server string, has func(*mcp.ServerCapabilities) bool) []*mcpConnection {
+	mcpConnectionsMu.Lock()
+	conns := make([]*mcpConnection, 0, len(mcpConnections))
+	for _, conn := range mcpConnections {
+		conns = append(conns, conn)
+	}
+	mcpConnectionsMu.Unlock()
+
+	var out []*mcpConnection
+	for _, conn := range conns {
+		if conn.caps == nil || !has(conn.caps) || (server != "" && !strings.EqualFold(conn.name, server)) {
+			continue
+		}
+		if !canAccess(serverAccessTool(conn, toolName), c) {
+			continue
+		}
+		if conn.authMode == pb.MCPAuthOAuth && !isOAuthLinked(conn.key, c.userID) {
+			continue
+		}
+		if server != "" && conn.owner == c.userID {
+			return []*mcpConnection{conn}
+		}
+		out = append(out, conn)
+	}
+	if server != "" && len(out) > 1 {
+		out = out[:1]
+	}
+	return out
+}
+
+func hasResources(caps *mcp.ServerCapabilities) bool { return caps.Resources != nil }
+
+// registerMCPResourceTools registers list_resources and read_resource as local,
+// public toolbelt tools; access is checked per server on each call.
+func registerMCPResourceTools() {
+	registerTool(&registeredTool{
+		Name:        "list_resources",
+		Description: "List the resources (files, documents, records) that connected MCP servers offer, with their URIs. Read one with read_resource.",
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"server": map[string]any{"type": "string", "description": "Only list this MCP server's resources (omit for all servers available to you)."},
+			},
+		},
+		Source:     "local",
+		Visibility: pb.MCPVisibilityPublic,
+		Invoke: func(ctx context.Context, userID, channelID, guildID string, args map[string]any) (string, error) {
+			c := newToolCaller(botSession.Load(), userID, channelID, guildID)
+			return listMCPResources(ctx, c, getStr(args, "server")), nil
+		},
+	})
+	registerTool(&registeredTool{
+		Name:        "read_resource",
+		Description: "Read a resource from a connected MCP server by its URI (from list_resources, or filled in from one of its URI templates).",
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"server": map[string]any{"type": "string", "description": "The MCP server name, as returned by list_resources."},
+				"uri":    map[string]any{"type": "string", "description": "The resource URI."},
+			},
+			"required": []string{"server", "uri"},
+		},
+		Source:     "local",
+		Visibility: pb.MCPVisibilityPublic,
+		Invoke: func(ctx context.Context, userID, channelID, guildID string, args map[string]any) (string, error) {
+			c := newToolCaller(botSession.Load(), userID, channelID, guildID)
+			return readMCPResource(ctx, c, getStr(args, "server"), getStr(args, "uri")), nil
+		},
+	})
+}
+
+func listMCPResources(ctx context.Context, c toolCaller, server string) string {
+	type resourceInfo struct {
+		URI         string `json:"uri,omitempty"`
+		URITemplate string `json:"uri_template,omitempty"`
+		Name        string `json:"name"`
+		Description string `json:"description,omitempty"`
+		MIMEType    string `json:"mime_type,omitempty"`
+	}
+	type serverInfo struct {
+		Server    string         `json:"server"`
+		Resources []resourceInfo `json:"resources"`
+		Error     string         `json:"error,omitempty"`
+	}
+
+	conns := accessibleConnections(c, "list_resources", server, hasResources)
+	if len(conns) == 0 {
+		if server != "" {
+			return jsonResult("error", fmt.Sprintf("no MCP server named %q with resources is available to you", server))
+		}
+		return jsonResult("success", "No connected MCP server available to you offers resources.")
+	}
+
+	servers := []serverInfo{}
+	for _, conn := range conns {
+		info := serverInfo{Server: conn.name, Resources: []resourceInfo{}}
+		session, err := sessionFor(ctx, conn, c.userID)
+		if err != nil {
+			info.Error = err.Error()
+			servers = append(servers, info)
+			continue
+		}
+		for r, err := range session.Resources(ctx, nil) {
+			if err != nil {
+				log.Warnf("Failed to list resources of MCP server %q: %v", conn.name, err)
+				info.Error = err.Error()
+				break
+			}
+			if len(info.Resources) >= maxListedResources {
+				break
+			}
+			info.Resources = append(info.Resources, resourceInfo{URI: r.URI, Name: r.Name, Description: r.Description, MIMEType: r.MIMEType})
+		}
+		for t, err := range session.ResourceTemplates(ctx, nil) {
+			if err != nil || len(info.Resources) >= maxListedResources {
+				break
+			}
+			info.Resources = append(info.Resources, resourceInfo{URITemplate: t.URITemplate, Name: t.Name, Description: t.Description, MIMEType: t.MIMEType})
+		}
+		servers = append(servers, info)
+	}
+	b, err := json.Marshal(map[string]any{"servers": servers})
+	if err != nil {
+		return jsonResult("error", "failed to serialize resource list")
+	}
+	return string(b)
+}
+
+func readMCPResource(ctx context.Context, c toolCaller, server, uri string) string {
+	conns := accessibleConnections(c, "read_resource", server, hasResources)
+	if len(conns) == 0 {
+		return jsonResult("error", fmt.Sprintf("no MCP server named %q with resources is available to you", server))
+	}
+	session, err := sessionFor(ctx, conns[0], c.userID)
+	if err != nil {
+		return jsonResult("error", err.Error())
+	}
+	res, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: uri})
+	if err != nil {
+		return jsonResult("error", err.Error())
+	}
+	var sb strings.Builder
+	for _, rc := range res.Contents {
+		if sb.Len() > 0 {
+			sb.WriteString("\n\n")
+		}
+		switch {
+		case rc.Text != "":
+			sb.WriteString(rc.Text)
+		case len(rc.Blob) > 0:
+			sb.WriteString(fmt.Sprintf("[binary content %s: %s, %d bytes]", rc.URI, rc.MIMEType, len(rc.Blob)))
+		}
+	}
+	if sb.Len() == 0 {
+		sb.WriteString("(empty resource)")
+	}
+	return jsonResult("success", sb.String())
+}
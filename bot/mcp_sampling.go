@@ -0,0 +1,339 @@
+package bot
+
+import (
+	"bitbot/pb"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/charmbracelet/log"
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// MCP servers can ask the bot to run a completion on its model (sampling).
+// Servers are opted in one by one with /mcp sampling, which also sets a token
+// cap per request and, optionally, per 24 hours, and whether an admin must
+// approve each request. Every completion is recorded in sampling_usage.
+
+const (
+	defaultSamplingMaxTokens = 1024
+	// maxSamplingMaxTokens bounds the per-request cap a server may be given.
+	maxSamplingMaxTokens    = 16384
+	samplingApprovalTimeout = 5 * time.Minute
+	// samplingRejected is the error code for a refused request, as in the MCP
+	// specification's example.
+	samplingRejected = -1
+)
+
+// samplingMinTokens is the lower bound of the /mcp sampling token options.
+var samplingMinTokens = 1.0
+
+func rejectSampling(format string, a ...any) error {
+	return &jsonrpc.Error{Code: samplingRejected, Message: fmt.Sprintf(format, a...)}
+}
+
+// sessionConnection returns the connection a session belongs to: the server's
+// own, or the server of a user's OAuth session.
+func sessionConnection(session *mcp.ClientSession) *mcpConnection {
+	if conn := connectionFor(session); conn != nil {
+		return conn
+	}
+	key := oauthSessionServer(session)
+	if key == "" {
+		return nil
+	}
+	mcpConnectionsMu.Lock()
+	defer mcpConnectionsMu.Unlock()
+	return mcpConnections[key]
+}
+
+// samplingMaxTokens is the most tokens one of srv's requests may generate.
+func samplingMaxTokens(srv *pb.MCPServer) int64 {
+	if srv.SamplingMaxTokens <= 0 {
+		return defaultSamplingMaxTokens
+	}
+	return int64(min(srv.SamplingMaxTokens, maxSamplingMaxTokens))
+}
+
+// handleSampling is the MCP client's sampling handler.
+func handleSampling(ctx context.Context, req *mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+	conn := sessionConnection(req.Session)
+	if conn == nil {
+		return nil, rejectSampling("sampling is not available")
+	}
+	srv, err := pb.GetMCPServerByID(conn.id)
+	if err != nil || srv == nil {
+		return nil, rejectSampling("sampling is not available")
+	}
+	if !srv.Sampling {
+		return nil, rejectSampling("sampling is not enabled for this server")
+	}
+
+	maxTokens := samplingMaxTokens(srv)
+	if req.Params.MaxTokens > 0 && req.Params.MaxTokens < maxTokens {
+		maxTokens = req.Params.MaxTokens
+	}
+	if srv.SamplingDailyTokens > 0 {
+		used, err := pb.SamplingTokensSince(conn.key, time.Now().Add(-24*time.Hour))
+		if err != nil {
+			log.Errorf("Failed to check sampling usage of %q: %v", conn.name, err)
+			return nil, rejectSampling("sampling is not available")
+		}
+		left := int64(srv.SamplingDailyTokens - used)
+		if left <= 0 {
+			return nil, rejectSampling("this server used its sampling budget of %d tokens for the last 24 hours", srv.SamplingDailyTokens)
+		}
+		maxTokens = min(maxTokens, left)
+	}
+
+	usage := &pb.SamplingUsage{Server: conn.key, Model: regoloModel}
+	call := elicitingCall(req.Session)
+	if call != nil {
+		usage.UserID = call.userID
+	}
+	if srv.SamplingApproval {
+		approver, err := askSamplingApproval(ctx, conn, call, req.Params, maxTokens)
+		if err != nil {
+			return nil, err
+		}
+		usage.ApproverID = approver
+	}
+
+	res, err := regoloComplete(ctx, chatRequest{
+		Messages:    samplingMessages(req.Params),
+		MaxTokens:   maxTokens,
+		Temperature: req.Params.Temperature,
+		Stop:        req.Params.StopSequences,
+	})
+	if err != nil {
+		log.Errorf("Sampling request from %q failed: %v", conn.name, err)
+		return nil, fmt.Errorf("completion failed")
+	}
+	choice := res.Choices[0]
+	if res.Usage != nil {
+		usage.PromptTokens, usage.CompletionTokens = res.Usage.PromptTokens, res.Usage.CompletionTokens
+	} else {
+		// Roughly four characters a token, for providers that don't report it.
+		for _, m := range samplingMessages(req.Params) {
+			usage.PromptTokens += len(m.Content) / 4
+		}
+		usage.CompletionTokens = len(choice.Message.Content) / 4
+	}
+	if err := pb.RecordSamplingUsage(usage); err != nil {
+		log.Errorf("Failed to record sampling usage: %v", err)
+	}
+	log.Infof("MCP server %q owner=%q sampled %d+%d tokens", conn.name, conn.owner, usage.PromptTokens, usage.CompletionTokens)
+
+	stop := "endTurn"
+	if choice.FinishReason == "length" {
+		stop = "maxTokens"
+	}
+	return &mcp.CreateMessageResult{
+		Content:    &mcp.TextContent{Text: choice.Message.Content},
+		Model:      regoloModel,
+		Role:       "assistant",
+		StopReason: stop,
+	}, nil
+}
+
+// samplingMessages converts a sampling request to chat messages. The model
+// only takes text, so other content is replaced by a note.
+func samplingMessages(p *mcp.CreateMessageParams) []Message {
+	var msgs []Message
+	if p.SystemPrompt != "" {
+		msgs = append(msgs, Message{Role: "system", Content: p.SystemPrompt})
+	}
+	for _, m := range p.Messages {
+		role := "user"
+		if m.Role == "assistant" {
+			role = "assistant"
+		}
+		text := ""
+		switch c := m.Content.(type) {
+		case *mcp.TextContent:
+			text = c.Text
+		case *mcp.ImageContent:
+			text = fmt.Sprintf("[%s image omitted]", c.MIMEType)
+		case *mcp.AudioContent:
+			text = fmt.Sprintf("[%s audio omitted]", c.MIMEType)
+		}
+		msgs = append(msgs, Message{Role: role, Content: text})
+	}
+	return msgs
+}
+
+// samplingApproval is a sampling request waiting for an admin.
+type samplingApproval struct {
+	decision chan samplingDecision
+}
+
+type samplingDecision struct {
+	adminID  string
+	approved bool
+}
+
+var (
+	samplingApprovals   = map[string]*samplingApproval{}
+	samplingApprovalsMu sync.Mutex
+)
+
+// askSamplingApproval posts an Approve/Deny prompt for the admins and waits
+// for a decision, returning the approving admin.
+func askSamplingApproval(ctx context.Context, conn *mcpConnection, call *mcpCall, p *mcp.CreateMessageParams, maxTokens int64) (string, error) {
+	s := botSession.Load()
+	if s == nil {
+		return "", rejectSampling("sampling needs an admin's approval, and none could be asked")
+	}
+	channelID := ""
+	if call != nil {
+		channelID = call.channelID
+	}
+	promptChannel := adminPromptChannel(s, channelID)
+	if promptChannel == "" {
+		return "", rejectSampling("sampling needs an admin's approval, and none could be asked")
+	}
+
+	deadline := time.Now().Add(samplingApprovalTimeout)
+	if call != nil {
+		if d, ok := call.ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+	}
+	id := newPromptID()
+	text := samplingApprovalText(conn, call, p, maxTokens, deadline)
+	msg, err := s.ChannelMessageSendComplex(promptChannel, &discordgo.MessageSend{
+		Content:         text,
+		Components:      samplingApprovalButtons(id, false),
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		log.Errorf("Failed to post sampling approval prompt: %v", err)
+		return "", rejectSampling("sampling needs an admin's approval, and none could be asked")
+	}
+	a := &samplingApproval{decision: make(chan samplingDecision, 1)}
+	samplingApprovalsMu.Lock()
+	samplingApprovals[id] = a
+	samplingApprovalsMu.Unlock()
+	defer func() {
+		samplingApprovalsMu.Lock()
+		delete(samplingApprovals, id)
+		samplingApprovalsMu.Unlock()
+	}()
+
+	var callDone <-chan struct{}
+	if call != nil {
+		callDone = call.ctx.Done()
+	}
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	var d samplingDecision
+	outcome := ""
+	select {
+	case d = <-a.decision:
+		if d.approved {
+			outcome = fmt.Sprintf("✅ Approved by <@%s>.", d.adminID)
+		} else {
+			outcome = fmt.Sprintf("🚫 Denied by <@%s>.", d.adminID)
+		}
+	case <-timer.C:
+		outcome = "⌛ No decision in time; denied."
+	case <-ctx.Done():
+		outcome = "Cancelled by the server."
+	case <-callDone:
+		outcome = "⌛ The tool call ended first; denied."
+	}
+	content := truncateToLimit(text+"\n"+outcome, discordMessageLimit)
+	components := samplingApprovalButtons(id, true)
+	if _, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{Channel: promptChannel, ID: msg.ID, Content: &content, Components: &components}); err != nil {
+		log.Warnf("Failed to update sampling approval prompt: %v", err)
+	}
+	if !d.approved {
+		return "", rejectSampling("the sampling request was not approved")
+	}
+	return d.adminID, nil
+}
+
+func samplingApprovalText(conn *mcpConnection, call *mcpCall, p *mcp.CreateMessageParams, maxTokens int64, deadline time.Time) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🤖 **Sampling request:** the MCP server `%s` wants to run a completion on the bot's model (up to %d tokens)", conn.name, maxTokens))
+	if call != nil {
+		sb.WriteString(fmt.Sprintf(" during <@%s>'s `%s` call in <#%s>", call.userID, call.tool, call.channelID))
+	}
+	sb.WriteString(".\n")
+	if p.SystemPrompt != "" {
+		sb.WriteString("System prompt:\n>>> " + truncateToLimit(p.SystemPrompt, 400) + "\n")
+	}
+	if n := len(p.Messages); n > 0 {
+		last := samplingMessages(&mcp.CreateMessageParams{Messages: p.Messages[n-1:]})[0]
+		sb.WriteString(fmt.Sprintf("Last of %d messages (%s):\n>>> %s\n", n, last.Role, truncateToLimit(last.Content, 1000)))
+	}
+	sb.WriteString(fmt.Sprintf("Expires <t:%d:R>.", deadline.Unix()))
+	return truncateToLimit(sb.String(), discordMessageLimit-100)
+}
+
+func samplingApprovalButtons(id string, disabled bool) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+		discordgo.Button{Label: "Approve", Style: discordgo.SuccessButton, CustomID: "sampling_approve_" + id, Disabled: disabled},
+		discordgo.Button{Label: "Deny", Style: discordgo.DangerButton, CustomID: "sampling_deny_" + id, Disabled: disabled},
+	}}}
+}
+
+// handleSamplingButton handles Approve/Deny on a sampling prompt. It reports
+// whether the interaction was one.
+func handleSamplingButton(s *discordgo.Session, i *discordgo.InteractionCreate) bool {
+	customID := i.MessageComponentData().CustomID
+	var id string
+	var approved bool
+	switch {
+	case strings.HasPrefix(customID, "sampling_approve_"):
+		id, approved = strings.TrimPrefix(customID, "sampling_approve_"), true
+	case strings.HasPrefix(customID, "sampling_deny_"):
+		id = strings.TrimPrefix(customID, "sampling_deny_")
+	default:
+		return false
+	}
+	adminID := getUserID(i)
+	if !authorizeSSH(s, i.GuildID, adminID) {
+		respondWithMessage(s, i, "Only an admin can decide sampling requests.")
+		return true
+	}
+	samplingApprovalsMu.Lock()
+	a := samplingApprovals[id]
+	samplingApprovalsMu.Unlock()
+	if a == nil {
+		respondWithMessage(s, i, "This request is no longer waiting for a decision.")
+		return true
+	}
+	select {
+	case a.decision <- samplingDecision{adminID: adminID, approved: approved}:
+	default:
+	}
+	// The waiting handler updates the message.
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseDeferredMessageUpdate})
+	return true
+}
+
+// samplingStatus describes a server's sampling settings and recent usage, for
+// /mcp status.
+func samplingStatus(srv *pb.MCPServer) string {
+	if !srv.Sampling {
+		return "Sampling: off"
+	}
+	status := fmt.Sprintf("Sampling: on — up to %d tokens per request", samplingMaxTokens(srv))
+	used, err := pb.SamplingTokensSince(serverKey(srv.Owner, srv.Name), time.Now().Add(-24*time.Hour))
+	if err == nil {
+		if srv.SamplingDailyTokens > 0 {
+			status += fmt.Sprintf(" — %d of %d tokens used in the last 24 hours", used, srv.SamplingDailyTokens)
+		} else {
+			status += fmt.Sprintf(" — %d tokens used in the last 24 hours", used)
+		}
+	}
+	if srv.SamplingApproval {
+		status += " — each request needs an admin's approval"
+	}
+	return status
+}
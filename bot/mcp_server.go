@@ -0,0 +1,381 @@
+package bot
+
+import (
+	"bitbot/pb"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/charmbracelet/log"
+	"github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// bitbot as an MCP server: a Streamable-HTTP endpoint at /mcp on the
+// PocketBase router exposes the reminder tools, the SSH tools and Discord
+// messaging to other agents and IDE assistants. Clients authenticate with a
+// per-user API token (/apitoken create). Every call runs as the token's owner,
+// with the same access checks, schema validation and audit log as a toolbelt
+// call from Discord.
+
+const mcpServerPath = "/mcp"
+
+// maxAPITokensPerUser bounds how many API tokens one user may hold.
+const maxAPITokensPerUser = 10
+
+// botSession is the bot's live Discord session, set once Run has connected.
+// MCP requests arrive on the PocketBase server's goroutines.
+var botSession atomic.Pointer[discordgo.Session]
+
+// serverTools returns the reminder and messaging tools offered by bitbot's MCP
+// server, keyed by name. The SSH tools are offered too, but resolved in the
+// toolbelt at call time so their admin visibility and tool policies apply.
+func serverTools() map[string]*registeredTool {
+	tools := map[string]*registeredTool{}
+	for _, def := range ReminderTools {
+		name := def.Function.Name
+		t := &registeredTool{
+			Name:        name,
+			Description: def.Function.Description,
+			InputSchema: def.Function.Parameters,
+			Source:      "local",
+			Visibility:  pb.MCPVisibilityPublic,
+		}
+		switch name {
+		case "add_reminder":
+			t.InputSchema = withProperty(def.Function.Parameters, "channel_id", map[string]any{
+				"type":        "string",
+				"description": "Discord channel ID to post the reminder in. Defaults to a DM to you.",
+			})
+			t.Invoke = invokeServerAddReminder
+		case "list_reminders":
+			t.Invoke = func(ctx context.Context, userID, channelID, guildID string, args map[string]any) (string, error) {
+				return sshResult(ListRemindersCore(userID))
+			}
+		case "delete_reminder":
+			t.Invoke = func(ctx context.Context, userID, channelID, guildID string, args map[string]any) (string, error) {
+				return sshResult(DeleteReminderCore(userID, getStr(args, "id")))
+			}
+		default:
+			continue
+		}
+		tools[name] = t
+	}
+	tools["send_message"] = &registeredTool{
+		Name:        "send_message",
+		Description: "Posts a message to a Discord channel as the bot. You must be allowed to send messages in that channel. @everyone and role mentions are not pinged.",
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"channel_id": map[string]any{"type": "string", "description": "The Discord channel ID."},
+				"content":    map[string]any{"type": "string", "description": "The message text (up to 2000 characters)."},
+			},
+			"required": []string{"channel_id", "content"},
+		},
+		Source:     "local",
+		Visibility: pb.MCPVisibilityPublic,
+		Invoke:     invokeServerSendMessage,
+	}
+	return tools
+}
+
+// withProperty returns a copy of an object schema with one more property.
+func withProperty(schema any, name string, prop map[string]any) map[string]any {
+	src, _ := schema.(map[string]interface{})
+	out := make(map[string]any, len(src))
+	for k, v := range src {
+		out[k] = v
+	}
+	props := map[string]any{}
+	if p, ok := src["properties"].(map[string]interface{}); ok {
+		for k, v := range p {
+			props[k] = v
+		}
+	}
+	props[name] = prop
+	out["properties"] = props
+	return out
+}
+
+// canPost reports whether userID may send messages in channelID.
+func canPost(s *discordgo.Session, userID, channelID string) bool {
+	perms, err := s.UserChannelPermissions(userID, channelID)
+	if err != nil {
+		return false
+	}
+	need := int64(discordgo.PermissionViewChannel | discordgo.PermissionSendMessages)
+	return perms&need == need
+}
+
+func invokeServerAddReminder(ctx context.Context, userID, channelID, guildID string, args map[string]any) (string, error) {
+	s := botSession.Load()
+	if s == nil {
+		return jsonResult("error", "the bot is not connected to Discord"), nil
+	}
+	target := getStr(args, "channel_id")
+	if target == "" {
+		dm, err := s.UserChannelCreate(userID)
+		if err != nil {
+			return jsonResult("error", "could not open a DM with you: "+err.Error()), nil
+		}
+		target = dm.ID
+	} else if !canPost(s, userID, target) {
+		return jsonResult("error", "you cannot post in that channel"), nil
+	}
+	return sshResult(AddReminderCore(userID, target, getStr(args, "who"), getStr(args, "when"), getStr(args, "message")))
+}
+
+func invokeServerSendMessage(ctx context.Context, userID, channelID, guildID string, args map[string]any) (string, error) {
+	s := botSession.Load()
+	if s == nil {
+		return jsonResult("error", "the bot is not connected to Discord"), nil
+	}
+	target, content := getStr(args, "channel_id"), strings.TrimSpace(getStr(args, "content"))
+	if content == "" {
+		return jsonResult("error", "content is empty"), nil
+	}
+	if !canPost(s, userID, target) {
+		return jsonResult("error", "you cannot post in that channel"), nil
+	}
+	msg, err := s.ChannelMessageSendComplex(target, &discordgo.MessageSend{
+		Content:         truncateToLimit(content, discordMessageLimit),
+		AllowedMentions: &discordgo.MessageAllowedMentions{Parse: []discordgo.AllowedMentionType{discordgo.AllowedMentionTypeUsers}},
+	})
+	if err != nil {
+		return jsonResult("error", "failed to send the message: "+err.Error()), nil
+	}
+	return jsonResult("success", "Message sent (ID "+msg.ID+")."), nil
+}
+
+// newBitbotMCPServer builds the MCP server with every exposed tool.
+func newBitbotMCPServer() *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "bitbot", Version: "1.0.0"}, &mcp.ServerOptions{
+		Instructions: "Tools of the bitbot Discord bot. Calls run as the Discord user who owns the API token.",
+	})
+	for name, t := range serverTools() {
+		server.AddTool(&mcp.Tool{Name: name, Description: t.Description, InputSchema: t.InputSchema}, serverToolHandler(name, t))
+	}
+	for _, def := range SSHTools {
+		name := def.Function.Name
+		server.AddTool(&mcp.Tool{Name: name, Description: def.Function.Description, InputSchema: def.Function.Parameters}, serverToolHandler(name, nil))
+	}
+	return server
+}
+
+// serverToolHandler runs one exposed tool for the token's owner. t is nil for
+// toolbelt tools, which are looked up per call. Every tool is access-checked,
+// so tool policies apply to the served ones too.
+func serverToolHandler(name string, t *registeredTool) mcp.ToolHandler {
+	return func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if req.Extra == nil || req.Extra.TokenInfo == nil || req.Extra.TokenInfo.UserID == "" {
+			return serverToolResult(jsonResult("error", "not authenticated"), nil), nil
+		}
+		userID := req.Extra.TokenInfo.UserID
+		args := map[string]any{}
+		if len(req.Params.Arguments) > 0 {
+			if err := json.Unmarshal(req.Params.Arguments, &args); err != nil || args == nil {
+				return serverToolResult(jsonResult("error", "arguments must be a JSON object"), nil), nil
+			}
+		}
+
+		caller := serverCaller(userID, getStr(args, "channel_id"))
+		tool := t
+		if tool == nil {
+			tool = lookupTool("local", name)
+		}
+		if tool == nil || !canAccess(tool, caller) {
+			return serverToolResult(jsonResult("error", fmt.Sprintf("%q is not available to you", name)), nil), nil
+		}
+		if errs := validateArgs(tool.InputSchema, args); len(errs) > 0 {
+			return serverToolResult(validationResult(name, errs), nil), nil
+		}
+		rule, err := approvalRuleFor(tool)
+		if err != nil {
+			return serverToolResult(jsonResult("error", err.Error()), nil), nil
+		}
+		// There is no one to click Confirm over MCP.
+		if tool.Destructive || rule != nil {
+			return serverToolResult(jsonResult("error", fmt.Sprintf("%q needs approval in Discord and cannot be called over MCP", name)), nil), nil
+		}
+
+		callCtx, cancel := context.WithTimeout(ctx, toolTimeout(tool))
+		defer cancel()
+		return serverToolResult(invokeTool(callCtx, tool, userID, "", caller.channelID, caller.guildID, args)), nil
+	}
+}
+
+// mcpServerGuild returns the guild whose roles apply to calls over MCP that
+// don't target a guild channel, or "" for none.
+func mcpServerGuild() string {
+	return strings.TrimSpace(os.Getenv("MCP_SERVER_GUILD_ID"))
+}
+
+// serverCaller builds the caller for a call over MCP by the token's owner. A
+// call that targets a channel is checked as if made there; otherwise the
+// owner's roles are looked up in MCP_SERVER_GUILD_ID. Either way role-based
+// admins and role, channel and guild policies apply as they do in Discord.
+func serverCaller(userID, channelID string) toolCaller {
+	s := botSession.Load()
+	guildID := mcpServerGuild()
+	if s != nil && channelID != "" {
+		ch, err := s.State.Channel(channelID)
+		if err != nil {
+			ch, err = s.Channel(channelID)
+		}
+		if err == nil && ch.GuildID != "" {
+			guildID = ch.GuildID
+		}
+	}
+	return newToolCaller(s, userID, channelID, guildID)
+}
+
+// serverToolResult converts a toolbelt result into an MCP tool result. A plain
+// {"status","message"} result is reduced to its message; anything richer (e.g.
+// validation errors) is passed on as JSON.
+func serverToolResult(result string, err error) *mcp.CallToolResult {
+	if err != nil {
+		return &mcp.CallToolResult{IsError: true, Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}}}
+	}
+	text := result
+	var r map[string]any
+	if json.Unmarshal([]byte(result), &r) == nil {
+		_, hasStatus := r["status"].(string)
+		msg, hasMessage := r["message"].(string)
+		plain := hasStatus && hasMessage && msg != ""
+		for k := range r {
+			plain = plain && (k == "status" || k == "message")
+		}
+		if plain {
+			text = msg
+		}
+	}
+	return &mcp.CallToolResult{
+		IsError: resultStatus(result, nil) == "error",
+		Content: []mcp.Content{&mcp.TextContent{Text: text}},
+	}
+}
+
+// verifyAPIToken authenticates an MCP request by its bearer API token.
+func verifyAPIToken(ctx context.Context, token string, r *http.Request) (*auth.TokenInfo, error) {
+	t, err := pb.LookupAPIToken(token)
+	if err != nil {
+		// The client gets a plain 401, not the database's error.
+		log.Errorf("Failed to look up an API token: %v", err)
+		return nil, fmt.Errorf("%w: the token could not be verified", auth.ErrInvalidToken)
+	}
+	if t == nil {
+		return nil, fmt.Errorf("%w: unknown API token", auth.ErrInvalidToken)
+	}
+	go func() {
+		if err := pb.TouchAPIToken(t); err != nil {
+			log.Warnf("Failed to record use of API token %s: %v", t.ID, err)
+		}
+	}()
+	// API tokens do not expire; they are revoked with /apitoken revoke.
+	return &auth.TokenInfo{UserID: t.UserID, Expiration: time.Now().Add(time.Hour)}, nil
+}
+
+// RegisterMCPServerRoutes binds bitbot's MCP endpoint on the PocketBase HTTP
+// server. Call before app.Start().
+func RegisterMCPServerRoutes(app core.App) {
+	server := newBitbotMCPServer()
+	handler := auth.RequireBearerToken(verifyAPIToken, nil)(
+		mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return server }, nil),
+	)
+	app.OnServe().BindFunc(func(e *core.ServeEvent) error {
+		e.Router.Any(mcpServerPath, apis.WrapStdHandler(handler))
+		return e.Next()
+	})
+	log.Infof("MCP server route registered at %s", mcpServerPath)
+}
+
+// --- /apitoken ---
+
+// HandleAPITokenCommand handles /apitoken, which manages the caller's tokens
+// for bitbot's MCP endpoint.
+func HandleAPITokenCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	if len(data.Options) == 0 {
+		respondWithMessage(s, i, "Unknown apitoken subcommand.")
+		return
+	}
+	caller := getUserID(i)
+	sub := data.Options[0]
+	optStr := func(name string) string {
+		for _, o := range sub.Options {
+			if o.Name == name {
+				return strings.TrimSpace(o.StringValue())
+			}
+		}
+		return ""
+	}
+
+	switch sub.Name {
+	case "create":
+		existing, err := pb.ListAPITokens(caller)
+		if err != nil {
+			log.Errorf("Failed to list API tokens: %v", err)
+			respondWithMessage(s, i, "Could not create a token. Please try again later.")
+			return
+		}
+		if len(existing) >= maxAPITokensPerUser {
+			respondWithMessage(s, i, fmt.Sprintf("You already have %d tokens. Revoke one with `/apitoken revoke` first.", len(existing)))
+			return
+		}
+		token, t, err := pb.CreateAPIToken(caller, optStr("name"))
+		if err != nil {
+			log.Errorf("Failed to create API token: %v", err)
+			respondWithMessage(s, i, "Could not create a token. Please try again later.")
+			return
+		}
+		respondWithMessage(s, i, fmt.Sprintf("🔑 Created token `%s`. Copy it now — it will not be shown again:\n```\n%s\n```\nUse it as a bearer token for the MCP endpoint at `%s`. Calls made with it run as you.", t.ID, token, mcpServerPath))
+	case "list":
+		tokens, err := pb.ListAPITokens(caller)
+		if err != nil {
+			log.Errorf("Failed to list API tokens: %v", err)
+			respondWithMessage(s, i, "Could not fetch your tokens. Please try again later.")
+			return
+		}
+		if len(tokens) == 0 {
+			respondWithMessage(s, i, "You have no API tokens. Create one with `/apitoken create`.")
+			return
+		}
+		var sb strings.Builder
+		sb.WriteString("**Your API tokens:**\n")
+		for _, t := range tokens {
+			name := t.Name
+			if name == "" {
+				name = "(unnamed)"
+			}
+			used := "never used"
+			if !t.LastUsedAt.IsZero() {
+				used = fmt.Sprintf("last used <t:%d:R>", t.LastUsedAt.Unix())
+			}
+			sb.WriteString(fmt.Sprintf("• `%s` — %s — ends in `%s` — created <t:%d:R>, %s\n", t.ID, name, t.Hint, t.CreatedAt.Unix(), used))
+		}
+		respondWithMessage(s, i, truncateToLimit(sb.String(), discordMessageLimit))
+	case "revoke":
+		id := optStr("id")
+		found, err := pb.DeleteAPIToken(id, caller)
+		if err != nil {
+			log.Errorf("Failed to revoke API token: %v", err)
+			respondWithMessage(s, i, "Could not revoke the token. Please try again later.")
+			return
+		}
+		if !found {
+			respondWithMessage(s, i, "You have no token with that ID.")
+			return
+		}
+		respondWithMessage(s, i, fmt.Sprintf("Token `%s` revoked.", id))
+	default:
+		respondWithMessage(s, i, "Unknown apitoken subcommand.")
+	}
+}
@@ -0,0 +1,238 @@
+package bot
+
+import (
+	"bitbot/pb"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Command servers are local processes the bot starts and speaks MCP to over
+// stdio. Adding one runs an arbitrary command on the bot's host, so only admins
+// can add them (/mcp is admin-only). The process is supervised: when it exits,
+// its tools are removed and it is restarted with exponential backoff. Its stderr
+// goes to the bot's log.
+
+const (
+	mcpRestartMinBackoff = 2 * time.Second
+	mcpRestartMaxBackoff = 5 * time.Minute
+	// mcpStableUptime is how long a process must stay up for its restart
+	// backoff to reset, so a crash loop keeps backing off.
+	mcpStableUptime = time.Minute
+	// maxStderrLine caps how much of one stderr line is logged.
+	maxStderrLine = 2000
+)
+
+// mcpCommandEnvPassthrough is the part of the bot's own environment a command
+// server inherits. Everything else (the Discord token, API keys) stays out;
+// a server's own env entries are added on top.
+var mcpCommandEnvPassthrough = []string{"PATH", "HOME", "USER", "LANG", "TMPDIR", "TZ"}
+
+var (
+	// mcpRestarting holds the keys of command servers being restarted by their
+	// supervisor, so the reconciler doesn't start a second copy meanwhile.
+	mcpRestarting   = map[string]bool{}
+	mcpRestartingMu sync.Mutex
+)
+
+func isRestarting(key string) bool {
+	mcpRestartingMu.Lock()
+	defer mcpRestartingMu.Unlock()
+	return mcpRestarting[key]
+}
+
+func setRestarting(key string, restarting bool) {
+	mcpRestartingMu.Lock()
+	defer mcpRestartingMu.Unlock()
+	if restarting {
+		mcpRestarting[key] = true
+	} else {
+		delete(mcpRestarting, key)
+	}
+}
+
+// commandTransport builds the stdio transport that starts srv's process.
+func commandTransport(srv *pb.MCPServer) *mcp.CommandTransport {
+	cmd := exec.Command(srv.Command, srv.Args...)
+	cmd.Dir = srv.Dir
+	for _, name := range mcpCommandEnvPassthrough {
+		if v, ok := os.LookupEnv(name); ok {
+			cmd.Env = append(cmd.Env, name+"="+v)
+		}
+	}
+	cmd.Env = append(cmd.Env, srv.Env...)
+	cmd.Stderr = &stderrLogger{server: srv.Name}
+	return &mcp.CommandTransport{Command: cmd}
+}
+
+// commandSpec summarizes what starts a command server, so the reconciler can
+// tell when it was reconfigured. It is empty for HTTP servers.
+func commandSpec(srv *pb.MCPServer) string {
+	if srv.Transport != pb.MCPTransportCommand {
+		return ""
+	}
+	return strings.Join([]string{srv.Command, strings.Join(srv.Args, "\x00"), strings.Join(srv.Env, "\x00"), srv.Dir}, "\x01")
+}
+
+// serverLocation describes where a server lives, for logs and /mcp list.
+func serverLocation(srv *pb.MCPServer) string {
+	if srv.Transport == pb.MCPTransportCommand {
+		return strings.TrimSpace("command: " + srv.Command + " " + strings.Join(srv.Args, " "))
+	}
+	return srv.URL
+}
+
+// superviseCommandServer watches a command server's session and restarts the
+// process when it exits on its own. It stops once the server is disconnected
+// on purpose (removed, disabled, or reconfigured, in which case the reconciler
+// starts a new supervisor).
+func superviseCommandServer(srv *pb.MCPServer, session *mcp.ClientSession) {
+	key := serverKey(srv.Owner, srv.Name)
+	backoff := mcpRestartMinBackoff
+	for {
+		started := time.Now()
+		err := session.Wait()
+		if !isCurrentSession(key, session) {
+			return
+		}
+		setRestarting(key, true)
+		disconnectMCPServer(key)
+		if time.Since(started) >= mcpStableUptime {
+			backoff = mcpRestartMinBackoff
+		}
+		exitMsg := "process exited"
+		if err != nil {
+			exitMsg += ": " + err.Error()
+		}
+		log.Warnf("MCP server %q owner=%q %s; restarting in %s", srv.Name, srv.Owner, exitMsg, backoff)
+		if perr := pb.RecordMCPServerError(srv.ID, exitMsg); perr != nil {
+			log.Warnf("Failed to record MCP server error: %v", perr)
+		}
+
+		for {
+			time.Sleep(backoff)
+			backoff = min(backoff*2, mcpRestartMaxBackoff)
+
+			current := desiredCommandServer(key)
+			if current == nil || commandSpec(current) != commandSpec(srv) {
+				// Removed or reconfigured while down: leave it to the reconciler.
+				setRestarting(key, false)
+				return
+			}
+			srv = current
+			session, err = openMCPServer(context.Background(), srv)
+			if err == nil {
+				break
+			}
+			log.Warnf("MCP server %q owner=%q failed to restart: %v; retrying in %s", srv.Name, srv.Owner, err, backoff)
+			if perr := pb.RecordMCPServerError(srv.ID, "restart failed: "+err.Error()); perr != nil {
+				log.Warnf("Failed to record MCP server error: %v", perr)
+			}
+		}
+		setRestarting(key, false)
+	}
+}
+
+// isCurrentSession reports whether session is still key's live connection.
+func isCurrentSession(key string, session *mcp.ClientSession) bool {
+	mcpConnectionsMu.Lock()
+	defer mcpConnectionsMu.Unlock()
+	conn := mcpConnections[key]
+	return conn != nil && conn.session == session
+}
+
+// desiredCommandServer returns key's current configuration if it is still an
+// enabled command server, or nil.
+func desiredCommandServer(key string) *pb.MCPServer {
+	servers, err := pb.ListMCPServers()
+	if err != nil {
+		return nil
+	}
+	for _, srv := range servers {
+		if serverKey(srv.Owner, srv.Name) == key && srv.Enabled && srv.Transport == pb.MCPTransportCommand {
+			return srv
+		}
+	}
+	return nil
+}
+
+// stderrLogger logs a command server's stderr, one line at a time.
+type stderrLogger struct {
+	server string
+	mu     sync.Mutex
+	buf    []byte
+}
+
+func (l *stderrLogger) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		l.logLine(l.buf[:i])
+		l.buf = l.buf[i+1:]
+	}
+	if len(l.buf) > maxStderrLine {
+		l.logLine(l.buf)
+		l.buf = nil
+	}
+	return len(p), nil
+}
+
+func (l *stderrLogger) logLine(line []byte) {
+	text := strings.TrimRight(string(line), "\r")
+	if len(text) > maxStderrLine {
+		text = text[:maxStderrLine] + "…"
+	}
+	if strings.TrimSpace(text) != "" {
+		log.Info("MCP server stderr", "server", l.server, "line", text)
+	}
+}
+
+// splitCommandLine splits args the way a shell would for simple cases:
+// whitespace separates words, and single or double quotes group them.
+func splitCommandLine(s string) ([]string, error) {
+	var words []string
+	var cur strings.Builder
+	inWord := false
+	var quote rune
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
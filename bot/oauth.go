@@ -2,8 +2,12 @@ package bot
 
 import (
 	"bitbot/pb"
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"net/url"
 	"os"
 	"strings"
@@ -16,12 +20,15 @@ import (
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/modelcontextprotocol/go-sdk/oauthex"
 	"github.com/pocketbase/pocketbase/core"
+	"golang.org/x/oauth2"
 )
 
 // OAuth linking flow for MCP servers whose auth_mode is "oauth". Each user
 // authorizes in a browser; the resulting session is per user. The bot bridges
 // the browser redirect back to the waiting authorization flow via a callback
-// endpoint keyed by the OAuth `state` parameter.
+// endpoint keyed by the OAuth `state` parameter. Tokens are stored (encrypted)
+// with the OAuth client they were issued to, so the reconciler can restore the
+// session after a restart and refresh expired tokens without the user.
 
 const oauthAuthorizeTimeout = 5 * time.Minute
 
@@ -144,8 +151,9 @@ func extractState(authURL string) string {
 }
 
 // newOAuthHandler builds a per-user OAuth handler using Dynamic Client
-// Registration, so no per-provider app registration is needed.
-func newOAuthHandler(session *discordgo.Session, userID, serverName string) (*auth.AuthorizationCodeHandler, error) {
+// Registration, so no per-provider app registration is needed. Its HTTP client
+// records the OAuth client used for the token exchange.
+func newOAuthHandler(session *discordgo.Session, userID, serverName string, recorder *oauthClientRecorder) (*auth.AuthorizationCodeHandler, error) {
 	redirect := oauthRedirectURL()
 	if redirect == "" {
 		return nil, fmt.Errorf("OAUTH_REDIRECT_BASE is not set; required for OAuth MCP servers")
@@ -159,51 +167,337 @@ func newOAuthHandler(session *discordgo.Session, userID, serverName string) (*au
 		},
 		RedirectURL:              redirect,
 		AuthorizationCodeFetcher: makeAuthorizationCodeFetcher(session, userID, serverName),
+		Client:                   &http.Client{Transport: recorder},
 	})
 }
 
 // linkOAuthServer runs the OAuth flow for the given server and, on success,
-// connects it and registers its tools (owned by the linking user). It blocks
-// until the flow completes or fails.
+// stores the user's token and connects the server with it, registering its
+// tools. It blocks until the flow completes or fails.
 func linkOAuthServer(ctx context.Context, session *discordgo.Session, userID string, srv *pb.MCPServer) error {
-	handler, err := newOAuthHandler(session, userID, srv.Name)
+	recorder := &oauthClientRecorder{base: http.DefaultTransport}
+	handler, err := newOAuthHandler(session, userID, srv.Name, recorder)
 	if err != nil {
 		return err
 	}
 
 	transport := &mcp.StreamableClientTransport{
-		Endpoint:             srv.URL,
-		OAuthHandler:         handler,
-		DisableStandaloneSSE: true,
+		Endpoint:     srv.URL,
+		OAuthHandler: handler,
 	}
-	client := mcp.NewClient(&mcp.Implementation{Name: "bitbot", Version: "1.0.0"}, nil)
-
 	// Connect triggers the OAuth flow (via the fetcher) if the server requires it.
-	cs, err := client.Connect(ctx, transport, nil)
+	cs, err := newMCPClient().Connect(ctx, transport, nil)
 	if err != nil {
 		return err
 	}
+	// The flow's session can't save refreshed tokens, so it is only used to
+	// obtain the token; the server is connected below from the stored copy.
+	defer cs.Close()
 
-	res, err := cs.ListTools(ctx, nil)
+	ts, err := handler.TokenSource(ctx)
+	if err != nil || ts == nil {
+		return fmt.Errorf("the server did not ask for authorization, so there is nothing to link")
+	}
+	tok, err := ts.Token()
 	if err != nil {
-		cs.Close()
 		return err
 	}
+	key := serverKey(srv.Owner, srv.Name)
+	stored := &pb.UserToken{
+		UserID:       userID,
+		Server:       key,
+		AccessToken:  tok.AccessToken,
+		RefreshToken: tok.RefreshToken,
+		TokenType:    tok.TokenType,
+		Expiry:       tok.Expiry,
+	}
+	if client := recorder.recorded(); client != nil {
+		stored.ClientID, stored.ClientSecret, stored.TokenURL, stored.AuthStyle = client.id, client.secret, client.tokenURL, int(client.style)
+	}
+	if err := pb.SaveUserToken(stored); err != nil {
+		return fmt.Errorf("failed to store the token: %w", err)
+	}
+	setNeedsReauth(key, userID, false)
+	setOAuthLinked(key, userID, true)
+	closeOAuthSessions(key, userID)
+
+	// Other users keep their own sessions; the shared connection (which lists
+	// the tools) is only replaced if it was this user's or there is none.
+	mcpConnectionsMu.Lock()
+	conn := mcpConnections[key]
+	mcpConnectionsMu.Unlock()
+	if conn != nil && conn.user != userID {
+		return nil
+	}
+	disconnectMCPServer(key)
+	return connectOAuthServerAs(ctx, srv, userID)
+}
+
+// errOAuthReauth means a stored OAuth token can no longer be used or refreshed,
+// so the user has to run /mcp link again.
+var errOAuthReauth = errors.New("authorization expired or was revoked; run /mcp link again")
 
-	registerServerTools(srv, cs, res)
+// errOAuthNotLinked means nobody (or, for a user's session, not that user) has
+// linked an OAuth server yet.
+var errOAuthNotLinked = errors.New("not linked yet")
+
+var (
+	// oauthReauth holds the (server, user) pairs whose stored token stopped
+	// working. They are not retried, and the user is told once, until they link
+	// again.
+	oauthReauth   = map[string]bool{}
+	oauthReauthMu sync.Mutex
+)
 
-	// Best-effort: persist the acquired token so it can be reused later.
-	if ts, terr := handler.TokenSource(ctx); terr == nil && ts != nil {
-		if tok, gerr := ts.Token(); gerr == nil && tok != nil {
-			_ = pb.SaveUserToken(&pb.UserToken{
-				UserID:       userID,
-				Server:       serverKey(srv.Owner, srv.Name),
-				AccessToken:  tok.AccessToken,
-				RefreshToken: tok.RefreshToken,
-				TokenType:    tok.TokenType,
-				Expiry:       tok.Expiry,
-			})
+// userServerKey identifies one user's link to one server.
+func userServerKey(server, userID string) string { return server + "\x00" + userID }
+
+func needsReauth(server, userID string) bool {
+	oauthReauthMu.Lock()
+	defer oauthReauthMu.Unlock()
+	return oauthReauth[userServerKey(server, userID)]
+}
+
+// setNeedsReauth marks or clears a pair, reporting whether it changed.
+func setNeedsReauth(server, userID string, needed bool) bool {
+	oauthReauthMu.Lock()
+	defer oauthReauthMu.Unlock()
+	k := userServerKey(server, userID)
+	if oauthReauth[k] == needed {
+		return false
+	}
+	if needed {
+		oauthReauth[k] = true
+	} else {
+		delete(oauthReauth, k)
+	}
+	return true
+}
+
+// requestReauth records that userID's token for srv stopped working and DMs
+// them, once, to link again.
+func requestReauth(srv *pb.MCPServer, userID string) {
+	key := serverKey(srv.Owner, srv.Name)
+	if !setNeedsReauth(key, userID, true) {
+		return
+	}
+	if err := pb.RecordMCPServerError(srv.ID, errOAuthReauth.Error()); err != nil {
+		log.Warnf("Failed to record MCP server error: %v", err)
+	}
+	s := botSession.Load()
+	if s == nil {
+		return
+	}
+	dm, err := s.UserChannelCreate(userID)
+	if err != nil {
+		log.Warnf("Failed to DM %s about re-linking %q: %v", userID, srv.Name, err)
+		return
+	}
+	s.ChannelMessageSend(dm.ID, fmt.Sprintf("🔑 Your authorization for the MCP server **%s** expired or was revoked. Run `/mcp link name:%s` to reconnect it.", srv.Name, srv.Name))
+}
+
+// connectOAuthServer restores an OAuth server's session from a stored token:
+// the owner's, or else that of whoever linked it most recently.
+func connectOAuthServer(ctx context.Context, srv *pb.MCPServer) error {
+	key := serverKey(srv.Owner, srv.Name)
+	users, err := pb.ListServerTokenUsers(key)
+	if err != nil {
+		return err
+	}
+	setOAuthLinks(key, users)
+	for i, u := range users {
+		if u == srv.Owner {
+			users[0], users[i] = users[i], users[0]
+		}
+	}
+	for _, u := range users {
+		if !needsReauth(key, u) {
+			return connectOAuthServerAs(ctx, srv, u)
 		}
 	}
+	return errOAuthNotLinked
+}
+
+// connectOAuthServerAs connects srv with userID's stored token and registers
+// its tools. That session also lists the tools and prompts for everyone; each
+// caller runs them with their own session (see oauth_sessions.go).
+func connectOAuthServerAs(ctx context.Context, srv *pb.MCPServer, userID string) error {
+	session, err := openOAuthSession(ctx, srv, userID)
+	if err != nil {
+		return err
+	}
+	listCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	res, err := session.ListTools(listCtx, nil)
+	if err != nil {
+		session.Close()
+		return err
+	}
+	registerServerTools(srv, session, res, userID)
 	return nil
 }
+
+// openOAuthSession connects to srv with userID's stored token, refreshing it
+// first if it has expired.
+func openOAuthSession(ctx context.Context, srv *pb.MCPServer, userID string) (*mcp.ClientSession, error) {
+	stored, err := pb.GetUserToken(userID, serverKey(srv.Owner, srv.Name))
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, errOAuthNotLinked
+	}
+
+	ts := &savingTokenSource{saved: stored}
+	tok := &oauth2.Token{AccessToken: stored.AccessToken, RefreshToken: stored.RefreshToken, TokenType: stored.TokenType, Expiry: stored.Expiry}
+	if stored.ClientID != "" && stored.TokenURL != "" {
+		cfg := &oauth2.Config{
+			ClientID:     stored.ClientID,
+			ClientSecret: stored.ClientSecret,
+			Endpoint:     oauth2.Endpoint{TokenURL: stored.TokenURL, AuthStyle: oauth2.AuthStyle(stored.AuthStyle)},
+		}
+		ts.base = cfg.TokenSource(context.Background(), tok)
+	} else {
+		// Linked before the client was recorded: usable until it expires.
+		ts.base = oauth2.StaticTokenSource(tok)
+		if !tok.Expiry.IsZero() && time.Now().After(tok.Expiry) {
+			requestReauth(srv, userID)
+			return nil, errOAuthReauth
+		}
+	}
+	// Refresh now if needed, so a revoked grant shows up here rather than on
+	// the first tool call.
+	if _, err := ts.Token(); err != nil {
+		if isOAuthGrantError(err) {
+			requestReauth(srv, userID)
+			return nil, errOAuthReauth
+		}
+		return nil, err
+	}
+
+	handler := &storedTokenHandler{ts: ts, onRejected: func() { dropOAuthUser(srv, userID) }}
+	transport := &mcp.StreamableClientTransport{Endpoint: srv.URL, OAuthHandler: handler}
+	connectCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	return newMCPClient().Connect(connectCtx, transport, nil)
+}
+
+// isOAuthGrantError reports whether a refresh failed because the grant itself
+// is no longer valid, as opposed to a network or server hiccup.
+func isOAuthGrantError(err error) bool {
+	var re *oauth2.RetrieveError
+	if !errors.As(err, &re) {
+		// oauth2 reports an expired token with no refresh token as a plain error.
+		return strings.Contains(err.Error(), "refresh token is not set")
+	}
+	if re.ErrorCode == "invalid_grant" || re.ErrorCode == "invalid_client" || re.ErrorCode == "unauthorized_client" {
+		return true
+	}
+	return re.Response != nil && (re.Response.StatusCode == http.StatusBadRequest || re.Response.StatusCode == http.StatusUnauthorized)
+}
+
+// storedTokenHandler authenticates a session restored from a stored token. It
+// can't run the interactive flow, so a rejected token means the user has to
+// link again.
+type storedTokenHandler struct {
+	ts         oauth2.TokenSource
+	onRejected func()
+}
+
+func (h *storedTokenHandler) TokenSource(context.Context) (oauth2.TokenSource, error) {
+	return h.ts, nil
+}
+
+func (h *storedTokenHandler) Authorize(_ context.Context, _ *http.Request, resp *http.Response) error {
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	go h.onRejected()
+	return errOAuthReauth
+}
+
+// savingTokenSource stores refreshed tokens, so the latest refresh token
+// survives a restart (providers may rotate it on every refresh).
+type savingTokenSource struct {
+	base  oauth2.TokenSource
+	mu    sync.Mutex
+	saved *pb.UserToken
+}
+
+func (s *savingTokenSource) Token() (*oauth2.Token, error) {
+	tok, err := s.base.Token()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if tok.AccessToken != s.saved.AccessToken {
+		updated := *s.saved
+		updated.AccessToken, updated.TokenType, updated.Expiry = tok.AccessToken, tok.TokenType, tok.Expiry
+		if tok.RefreshToken != "" {
+			updated.RefreshToken = tok.RefreshToken
+		}
+		if err := pb.SaveUserToken(&updated); err != nil {
+			log.Warnf("Failed to store a refreshed OAuth token for %s: %v", updated.Server, err)
+		}
+		s.saved = &updated
+	}
+	return tok, nil
+}
+
+// oauthClient is the OAuth client a token was issued to.
+type oauthClient struct {
+	id, secret, tokenURL string
+	style                oauth2.AuthStyle
+}
+
+// oauthClientRecorder watches the token exchange of a /mcp link flow and keeps
+// the OAuth client it used. The SDK registers the client (Dynamic Client
+// Registration) without exposing it, but refreshing the token later needs it.
+type oauthClientRecorder struct {
+	base   http.RoundTripper
+	mu     sync.Mutex
+	client *oauthClient
+}
+
+func (r *oauthClientRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodPost || req.Body == nil || !strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		return r.base.RoundTrip(req)
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	resp, err := r.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+
+	form, perr := url.ParseQuery(string(body))
+	if perr != nil || form.Get("grant_type") != "authorization_code" {
+		return resp, nil
+	}
+	client := &oauthClient{id: form.Get("client_id"), secret: form.Get("client_secret"), tokenURL: req.URL.String(), style: oauth2.AuthStyleInParams}
+	if id, secret, ok := req.BasicAuth(); ok {
+		// oauth2 escapes the credentials before sending them as basic auth.
+		client.id, client.secret, client.style = id, secret, oauth2.AuthStyleInHeader
+		if v, err := url.QueryUnescape(id); err == nil {
+			client.id = v
+		}
+		if v, err := url.QueryUnescape(secret); err == nil {
+			client.secret = v
+		}
+	}
+	r.mu.Lock()
+	r.client = client
+	r.mu.Unlock()
+	return resp, nil
+}
+
+func (r *oauthClientRecorder) recorded() *oauthClient {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.client
+}
@@ -0,0 +1,162 @@
+package bot
+
+import (
+	"bitbot/pb"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// An OAuth server is shared by everyone it is visible to, but each user acts
+// as themselves on it: the server's connection (opened with one linked user's
+// token) only lists its tools and prompts, and every call runs on the caller's
+// own session, opened on first use from their stored token. Users who haven't
+// linked the server don't see its tools as available; calling one tells them to
+// run /mcp link.
+
+var (
+	// oauthLinks holds, per server key, the users with a stored token.
+	oauthLinks   = map[string]map[string]bool{}
+	oauthLinksMu sync.Mutex
+
+	// oauthSessions holds users' own sessions, keyed by userServerKey.
+	oauthSessions   = map[string]*mcp.ClientSession{}
+	oauthSessionsMu sync.Mutex
+)
+
+// setOAuthLinks replaces the users linked to a server.
+func setOAuthLinks(key string, users []string) {
+	linked := make(map[string]bool, len(users))
+	for _, u := range users {
+		linked[u] = true
+	}
+	oauthLinksMu.Lock()
+	oauthLinks[key] = linked
+	oauthLinksMu.Unlock()
+}
+
+func setOAuthLinked(key, userID string, linked bool) {
+	oauthLinksMu.Lock()
+	defer oauthLinksMu.Unlock()
+	if oauthLinks[key] == nil {
+		oauthLinks[key] = map[string]bool{}
+	}
+	if linked {
+		oauthLinks[key][userID] = true
+	} else {
+		delete(oauthLinks[key], userID)
+	}
+}
+
+// isOAuthLinked reports whether userID has a working link to a server.
+func isOAuthLinked(key, userID string) bool {
+	oauthLinksMu.Lock()
+	linked := oauthLinks[key][userID]
+	oauthLinksMu.Unlock()
+	return linked && !needsReauth(key, userID)
+}
+
+// linkPrompt tells a user how to link a server.
+func linkPrompt(server string) string {
+	return fmt.Sprintf("the MCP server %q runs tools as you, and you haven't linked your account; ask the user to run `/mcp link name:%s` first", server, server)
+}
+
+// sessionFor returns the session to use for userID's calls on conn: their own
+// for OAuth servers, else the server's connection.
+func sessionFor(ctx context.Context, conn *mcpConnection, userID string) (*mcp.ClientSession, error) {
+	if conn.authMode != pb.MCPAuthOAuth || conn.user == userID {
+		return conn.session, nil
+	}
+	if !isOAuthLinked(conn.key, userID) {
+		return nil, errors.New(linkPrompt(conn.name))
+	}
+	k := userServerKey(conn.key, userID)
+	oauthSessionsMu.Lock()
+	session := oauthSessions[k]
+	oauthSessionsMu.Unlock()
+	if session != nil {
+		return session, nil
+	}
+
+	srv := &pb.MCPServer{ID: conn.id, Name: conn.name, Owner: conn.owner, URL: conn.url, AuthMode: conn.authMode}
+	session, err := openOAuthSession(ctx, srv, userID)
+	if errors.Is(err, errOAuthNotLinked) || errors.Is(err, errOAuthReauth) {
+		return nil, errors.New(linkPrompt(conn.name))
+	}
+	if err != nil {
+		return nil, err
+	}
+	oauthSessionsMu.Lock()
+	defer oauthSessionsMu.Unlock()
+	if existing := oauthSessions[k]; existing != nil {
+		// Opened concurrently by another call.
+		session.Close()
+		return existing, nil
+	}
+	oauthSessions[k] = session
+	return session, nil
+}
+
+// forgetOAuthSession drops userID's session on a server if it is session, e.g.
+// after its connection was lost, so the next call opens a new one.
+func forgetOAuthSession(key, userID string, session *mcp.ClientSession) {
+	k := userServerKey(key, userID)
+	oauthSessionsMu.Lock()
+	if oauthSessions[k] != session {
+		oauthSessionsMu.Unlock()
+		return
+	}
+	delete(oauthSessions, k)
+	oauthSessionsMu.Unlock()
+	session.Close()
+}
+
+// closeOAuthSessions closes userID's session on a server, or every user's
+// session when userID is "".
+func closeOAuthSessions(key, userID string) {
+	oauthSessionsMu.Lock()
+	var closing []*mcp.ClientSession
+	for k, session := range oauthSessions {
+		if k == userServerKey(key, userID) || (userID == "" && strings.HasPrefix(k, key+"\x00")) {
+			closing = append(closing, session)
+			delete(oauthSessions, k)
+		}
+	}
+	oauthSessionsMu.Unlock()
+	for _, session := range closing {
+		session.Close()
+	}
+}
+
+// dropOAuthUser handles a server rejecting userID's token: they are asked to
+// link again and their session is closed. If theirs was the server's
+// connection, it is disconnected and the reconciler reconnects it with another
+// linked user's token.
+func dropOAuthUser(srv *pb.MCPServer, userID string) {
+	key := serverKey(srv.Owner, srv.Name)
+	requestReauth(srv, userID)
+	closeOAuthSessions(key, userID)
+	mcpConnectionsMu.Lock()
+	conn := mcpConnections[key]
+	mcpConnectionsMu.Unlock()
+	if conn != nil && conn.user == userID {
+		disconnectMCPServer(key)
+	}
+}
+
+// oauthSessionServer returns the server key of a user's own session, or "".
+func oauthSessionServer(session *mcp.ClientSession) string {
+	oauthSessionsMu.Lock()
+	defer oauthSessionsMu.Unlock()
+	for k, s := range oauthSessions {
+		if s == session {
+			key, _, _ := strings.Cut(k, "\x00")
+			return key
+		}
+	}
+	return ""
+}
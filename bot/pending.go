@@ -0,0 +1,391 @@
+package bot
+
+import (
+	"bitbot/pb"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/charmbracelet/log"
+)
+
+// Confirmation flow for destructive (and guarded) tools. Each request is a
+// pending_actions record with an expiry, so prompts survive restarts and stop
+// working once stale. When an action is decided or expires, its prompt message
+// is edited to show who decided and the outcome, and its buttons are disabled.
+
+// pendingActionTTL is how long a confirmation prompt stays actionable.
+const pendingActionTTL = 15 * time.Minute
+
+// requestConfirmation records a pending call of t and posts its Confirm/Cancel
+// prompt, with header explaining why confirmation is needed. rule, if non-nil,
+// is the approval policy the call falls under (see approval.go).
+func requestConfirmation(s *discordgo.Session, t *registeredTool, args map[string]any, userID, channelID, guildID, header string, rule *pb.ApprovalPolicy) error {
+	return postPendingAction(s, newPendingAction(t, args, userID, channelID, guildID, rule), header)
+}
+
+// newPendingAction builds (but does not save) a pending call of t.
+func newPendingAction(t *registeredTool, args map[string]any, userID, channelID, guildID string, rule *pb.ApprovalPolicy) *pb.PendingAction {
+	argsJSON, _ := json.Marshal(args)
+	p := &pb.PendingAction{
+		Tool:      t.Name,
+		Source:    t.Source,
+		Args:      string(argsJSON),
+		UserID:    userID,
+		ChannelID: channelID,
+		GuildID:   guildID,
+		ExpiresAt: time.Now().Add(pendingActionTTL),
+	}
+	if rule != nil {
+		p.RequiredApprovals = rule.ApproversRequired
+		p.ExcludeRequester = rule.ExcludeRequester
+		p.ApproverRoles = rule.ApproverRoles
+	}
+	return p
+}
+
+// postPendingAction saves p and posts its prompt in p.PromptChannel().
+func postPendingAction(s *discordgo.Session, p *pb.PendingAction, header string) error {
+	if err := pb.CreatePendingAction(p); err != nil {
+		return err
+	}
+
+	prompt := truncateToLimit(fmt.Sprintf("%s\n```json\n%s\n```", header, p.Args), discordMessageLimit-120)
+	content := prompt + "\n" + approvalFooter(p, nil)
+	msg, err := s.ChannelMessageSendComplex(p.PromptChannel(), &discordgo.MessageSend{
+		Content:    content,
+		Components: confirmButtons(p, false),
+	})
+	if err != nil {
+		_ = pb.DeletePendingAction(p.ID)
+		return err
+	}
+	if err := pb.SetPendingActionMessage(p.ID, msg.ID, prompt); err != nil {
+		log.Warnf("Failed to record prompt message for pending action %s: %v", p.ID, err)
+	}
+	return nil
+}
+
+func confirmButtons(p *pb.PendingAction, disabled bool) []discordgo.MessageComponent {
+	yes, no := "Confirm", "Cancel"
+	if p.Kind == pb.PendingKindAccess {
+		yes, no = "Approve", "Deny"
+	}
+	return []discordgo.MessageComponent{
+		&discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			&discordgo.Button{Label: yes, Style: discordgo.DangerButton, CustomID: "tb_confirm_" + p.ID, Disabled: disabled},
+			&discordgo.Button{Label: no, Style: discordgo.SecondaryButton, CustomID: "tb_cancel_" + p.ID, Disabled: disabled},
+		}},
+	}
+}
+
+// updatePromptProgress shows the approvals so far on a pending action's prompt.
+func updatePromptProgress(s *discordgo.Session, p *pb.PendingAction, approvers []string) {
+	if p.MessageID == "" {
+		return
+	}
+	content := truncateToLimit(p.Prompt+"\n"+approvalFooter(p, approvers), discordMessageLimit)
+	if _, err := s.ChannelMessageEdit(p.PromptChannel(), p.MessageID, content); err != nil {
+		log.Warnf("Failed to update prompt for pending action %s: %v", p.ID, err)
+	}
+}
+
+// finalizePrompt edits a pending action's prompt to show its outcome and
+// disables the buttons.
+func finalizePrompt(s *discordgo.Session, p *pb.PendingAction, outcome string) {
+	if p.MessageID == "" {
+		return
+	}
+	content := truncateToLimit(p.Prompt+"\n"+outcome, discordMessageLimit)
+	components := confirmButtons(p, true)
+	if _, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		ID:         p.MessageID,
+		Channel:    p.PromptChannel(),
+		Content:    &content,
+		Components: &components,
+	}); err != nil {
+		log.Warnf("Failed to update prompt for pending action %s: %v", p.ID, err)
+	}
+}
+
+// handleToolbeltButton handles the Confirm/Cancel buttons for a pending tool
+// call. Returns true if it handled the interaction. Admins (or the approver
+// roles of the action's approval policy) vote; the tool runs once the required
+// number of approvals is reached, and any eligible voter can cancel. The
+// outcome of an access request is also posted in the channel it came from.
+func handleToolbeltButton(s *discordgo.Session, i *discordgo.InteractionCreate) bool {
+	customID := i.MessageComponentData().CustomID
+	var id string
+	var confirm bool
+	switch {
+	case strings.HasPrefix(customID, "tb_confirm_"):
+		id, confirm = strings.TrimPrefix(customID, "tb_confirm_"), true
+	case strings.HasPrefix(customID, "tb_cancel_"):
+		id = strings.TrimPrefix(customID, "tb_cancel_")
+	default:
+		return false
+	}
+
+	voter := getUserID(i)
+	p, err := pb.GetPendingAction(id)
+	if err != nil {
+		respondWithMessage(s, i, "This confirmation has expired or was already handled.")
+		return true
+	}
+	guildID := i.GuildID
+	if guildID == "" {
+		guildID = p.GuildID // an access request prompt in the admin's DMs
+	}
+	// The requester may always withdraw their own request.
+	if ok, why := canVote(s, guildID, voter, p); !ok && (confirm || voter != p.UserID) {
+		respondWithMessage(s, i, why)
+		return true
+	}
+
+	if !confirm {
+		votesMu.Lock()
+		if err := pb.RecordApprovalVote(p.ID, voter, pb.VoteDeny); err != nil && !errors.Is(err, pb.ErrAlreadyVoted) {
+			log.Warnf("Failed to record vote on pending action %s: %v", p.ID, err)
+		}
+		p, err = pb.ClaimPendingAction(id, pb.PendingStatusCancelled, voter)
+		votesMu.Unlock()
+		if err != nil {
+			respondHandled(s, i, p, err)
+			return true
+		}
+		if p.Kind == pb.PendingKindAccess {
+			finalizePrompt(s, p, fmt.Sprintf("❌ Denied by <@%s>.", voter))
+			if voter != p.UserID {
+				notifyRequester(s, p, fmt.Sprintf("❌ <@%s>, your request to run `%s` was denied.", p.UserID, p.Tool), "")
+			}
+			respondWithMessage(s, i, fmt.Sprintf("❌ Denied `%s`.", p.Tool))
+			return true
+		}
+		finalizePrompt(s, p, fmt.Sprintf("❌ Cancelled by <@%s>.", voter))
+		respondWithMessage(s, i, fmt.Sprintf("❌ Cancelled `%s`.", p.Tool))
+		return true
+	}
+
+	p, approvers, ok := castApproval(s, i, p, voter)
+	if !ok {
+		return true
+	}
+	approvedBy := userMentions(approvers)
+
+	t := lookupTool(p.Source, p.Tool)
+	if t == nil {
+		outcome := fmt.Sprintf("⚠️ Approved by %s, but `%s` is no longer available.", approvedBy, p.Tool)
+		_ = pb.SetPendingActionOutcome(p.ID, "error: tool unavailable")
+		finalizePrompt(s, p, outcome)
+		if p.Kind == pb.PendingKindAccess {
+			notifyRequester(s, p, fmt.Sprintf("⚠️ <@%s>, your request to run `%s` was approved, but the tool is no longer available.", p.UserID, p.Tool), "")
+		}
+		respondWithMessage(s, i, outcome)
+		return true
+	}
+	args := map[string]any{}
+	_ = json.Unmarshal([]byte(p.Args), &args)
+
+	// The interaction must be answered within seconds, so a tool that may run
+	// longer than a chat turn runs in the background and posts its result.
+	if timeout := toolTimeout(t); timeout > toolTurnWait {
+		respondWithMessage(s, i, fmt.Sprintf("▶️ Approved; `%s` is running (time limit %s). The result will be posted in <#%s>.", t.Name, formatDuration(timeout), p.ChannelID))
+		go runApprovedTool(s, nil, p, t, args, approvers)
+		return true
+	}
+	runApprovedTool(s, i, p, t, args, approvers)
+	return true
+}
+
+// runApprovedTool runs an approved action and reports the outcome: to the
+// approver answering i, or in the action's channel when i is nil.
+func runApprovedTool(s *discordgo.Session, i *discordgo.InteractionCreate, p *pb.PendingAction, t *registeredTool, args map[string]any, approvers []string) {
+	approver := strings.Join(approvers, ",")
+	approvedBy := userMentions(approvers)
+
+	ctx, cancel := context.WithTimeout(context.Background(), toolTimeout(t))
+	defer cancel()
+	attachments := &toolAttachments{}
+	progress := newToolProgress(s, p.ChannelID, t.Name)
+	ctx = withToolProgress(withToolAttachments(ctx, attachments), progress)
+	result, err := invokeTool(ctx, t, p.UserID, approver, p.ChannelID, p.GuildID, args)
+	progress.finish(resultStatus(result, err) == "success")
+	if err != nil {
+		_ = pb.SetPendingActionOutcome(p.ID, "error: "+truncateToLimit(err.Error(), 500))
+		finalizePrompt(s, p, fmt.Sprintf("⚠️ Approved by %s — failed.", approvedBy))
+		if p.Kind == pb.PendingKindAccess {
+			notifyRequester(s, p, fmt.Sprintf("⚠️ <@%s>, your request to run `%s` was approved by %s, but it failed: %v", p.UserID, t.Name, approvedBy, err), "")
+		}
+		if i == nil {
+			if p.Kind != pb.PendingKindAccess {
+				postToolResult(s, p.UserID, p.ChannelID, t.Name, time.Since(progress.start), "", err, nil)
+			}
+			return
+		}
+		respondWithMessage(s, i, fmt.Sprintf("⚠️ `%s` failed: %v", t.Name, err))
+		return
+	}
+	status := resultStatus(result, nil)
+	_ = pb.SetPendingActionOutcome(p.ID, status)
+	if status == "success" {
+		finalizePrompt(s, p, fmt.Sprintf("✅ Approved by %s — executed.", approvedBy))
+	} else {
+		finalizePrompt(s, p, fmt.Sprintf("⚠️ Approved by %s — the tool reported an error.", approvedBy))
+	}
+	if p.Kind == pb.PendingKindAccess {
+		notifyRequester(s, p, fmt.Sprintf("✅ <@%s>, your request to run `%s` was approved by %s:", p.UserID, t.Name, approvedBy), result, attachments.take()...)
+		if i != nil {
+			respondWithMessage(s, i, fmt.Sprintf("✅ Approved `%s`; the result was posted in <#%s>.", t.Name, p.ChannelID))
+		}
+		return
+	}
+	if i == nil {
+		postToolResult(s, p.UserID, p.ChannelID, t.Name, time.Since(progress.start), result, nil, attachments.take())
+		return
+	}
+
+	msg := fmt.Sprintf("✅ Executed `%s`:\n%s", t.Name, result)
+	files := attachments.take()
+	if utf8.RuneCountInString(msg) > discordMessageLimit {
+		// Too long for a message: show the start and attach the full result.
+		msg = truncateToLimit(msg, discordMessageLimit-40) + "\n… (full result attached)"
+		files = append(files, textAttachment(t.Name, result))
+	}
+	respondWithMessage(s, i, &discordgo.MessageSend{Content: msg, Files: files})
+}
+
+// votesMu serializes vote counting and the final claim, so two approvals
+// arriving together cannot both see a short quorum or both run the tool.
+var votesMu sync.Mutex
+
+// castApproval records voter's approval of p. Once the quorum is reached it
+// claims the action and returns it with the approvers (ok true); otherwise it
+// answers the interaction itself (progress, duplicate vote, or already
+// handled) and returns ok false.
+func castApproval(s *discordgo.Session, i *discordgo.InteractionCreate, p *pb.PendingAction, voter string) (*pb.PendingAction, []string, bool) {
+	votesMu.Lock()
+	defer votesMu.Unlock()
+
+	if p.Status != pb.PendingStatusPending || time.Now().After(p.ExpiresAt) {
+		// Claiming marks an expired action as such and reports it handled.
+		claimed, err := pb.ClaimPendingAction(p.ID, pb.PendingStatusApproved, voter)
+		if err == nil {
+			err = pb.ErrPendingHandled
+		}
+		respondHandled(s, i, claimed, err)
+		return nil, nil, false
+	}
+	if err := pb.RecordApprovalVote(p.ID, voter, pb.VoteApprove); err != nil {
+		if errors.Is(err, pb.ErrAlreadyVoted) {
+			respondWithMessage(s, i, "You have already voted on this action.")
+		} else {
+			log.Errorf("Failed to record vote on pending action %s: %v", p.ID, err)
+			respondWithMessage(s, i, "Failed to record your vote. Please try again.")
+		}
+		return nil, nil, false
+	}
+	votes, err := pb.ListApprovalVotes(p.ID)
+	if err != nil {
+		log.Errorf("Failed to load votes for pending action %s: %v", p.ID, err)
+		respondWithMessage(s, i, "Your vote was recorded, but the tally could not be checked.")
+		return nil, nil, false
+	}
+	approvers := approveVoters(votes)
+	if len(approvers) < p.RequiredApprovals {
+		updatePromptProgress(s, p, approvers)
+		respondWithMessage(s, i, fmt.Sprintf("🗳️ Approval recorded (%d/%d). The action runs once enough approvers agree.", len(approvers), p.RequiredApprovals))
+		return nil, nil, false
+	}
+	claimed, err := pb.ClaimPendingAction(p.ID, pb.PendingStatusApproved, voter)
+	if err != nil {
+		respondHandled(s, i, claimed, err)
+		return nil, nil, false
+	}
+	return claimed, approvers, true
+}
+
+// respondHandled answers a click on an action that can no longer be decided,
+// finalizing its prompt if it turned out to be expired.
+func respondHandled(s *discordgo.Session, i *discordgo.InteractionCreate, p *pb.PendingAction, err error) {
+	if errors.Is(err, pb.ErrPendingHandled) && p.Status == pb.PendingStatusExpired {
+		finalizeExpired(s, p)
+	}
+	respondWithMessage(s, i, "This confirmation has expired or was already handled.")
+}
+
+// StartPendingActionSweeper periodically expires stale confirmations and
+// updates their prompts.
+func StartPendingActionSweeper(s *discordgo.Session) {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		expired, err := pb.ExpirePendingActions()
+		if err != nil {
+			log.Errorf("Failed to expire pending actions: %v", err)
+		}
+		for _, p := range expired {
+			finalizeExpired(s, p)
+		}
+	}
+}
+
+// finalizeExpired marks an expired action's prompt, and tells the requester
+// when it was an access request.
+func finalizeExpired(s *discordgo.Session, p *pb.PendingAction) {
+	finalizePrompt(s, p, "⌛ Expired without a decision.")
+	if p.Kind == pb.PendingKindAccess {
+		notifyRequester(s, p, fmt.Sprintf("⌛ <@%s>, your request to run `%s` expired without an admin's decision.", p.UserID, p.Tool), "")
+	}
+}
+
+// HandlePendingCommand handles /pending: admins see every outstanding
+// approval, everyone else sees their own requests.
+func HandlePendingCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	var roles []string
+	if i.Member != nil {
+		roles = i.Member.Roles
+	}
+	caller := getUserID(i)
+	filter := caller
+	if CheckAdmin(caller, roles) {
+		filter = ""
+	}
+	actions, err := pb.ListPendingActions(filter)
+	if err != nil {
+		log.Errorf("Failed to list pending actions: %v", err)
+		respondWithMessage(s, i, "Could not fetch pending approvals. Please try again later.")
+		return
+	}
+	if len(actions) == 0 {
+		respondWithMessage(s, i, "No approvals are pending.")
+		return
+	}
+	var sb strings.Builder
+	sb.WriteString("**Pending approvals:**\n")
+	for _, p := range actions {
+		kind := ""
+		if p.Kind == pb.PendingKindAccess {
+			kind = " (access request)"
+		}
+		sb.WriteString(fmt.Sprintf("• `%s`%s requested by <@%s> — expires <t:%d:R>", p.Tool, kind, p.UserID, p.ExpiresAt.Unix()))
+		if p.MessageID != "" {
+			sb.WriteString(" — " + pendingPromptLink(p))
+		}
+		sb.WriteString("\n")
+	}
+	respondWithMessage(s, i, truncateToLimit(sb.String(), discordMessageLimit))
+}
+
+// messageLink returns a jump link to a Discord message.
+func messageLink(guildID, channelID, messageID string) string {
+	if guildID == "" {
+		guildID = "@me"
+	}
+	return fmt.Sprintf("https://discord.com/channels/%s/%s/%s", guildID, channelID, messageID)
+}
@@ -0,0 +1,286 @@
+package bot
+
+import (
+	"bitbot/pb"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/charmbracelet/log"
+)
+
+// Tool policies refine toolbelt access beyond owner + visibility. A policy
+// allows or denies tools (by exact name, glob, or MCP server) for a Discord
+// role, user, channel or guild:
+//
+//   - deny always wins, even over ownership;
+//   - allow grants admins-visibility tools to non-admins (it cannot expose
+//     another user's private server);
+//   - public tools stay available unless denied.
+
+// toolCaller is who is calling a toolbelt tool, and from where.
+type toolCaller struct {
+	userID    string
+	channelID string
+	guildID   string
+	roles     []string
+	isAdmin   bool
+}
+
+// newToolCaller resolves the caller's guild roles (when there is a guild) so
+// role policies and role-based admin checks apply.
+func newToolCaller(s *discordgo.Session, userID, channelID, guildID string) toolCaller {
+	c := toolCaller{userID: userID, channelID: channelID, guildID: guildID}
+	if s != nil && guildID != "" {
+		if member, err := s.GuildMember(guildID, userID); err == nil {
+			c.roles = member.Roles
+		}
+	}
+	c.isAdmin = CheckAdmin(userID, c.roles)
+	return c
+}
+
+// policyCacheTTL bounds how stale the in-memory policy list may get when it is
+// edited outside the bot (e.g. in the PocketBase admin UI).
+const policyCacheTTL = time.Minute
+
+var (
+	policyCacheMu sync.Mutex
+	policyCache   []*pb.ToolPolicy
+	policyCacheAt time.Time
+)
+
+// toolPolicies returns the current policies, reloading them when the cache is
+// stale. When they cannot be loaded it returns an error and callers deny
+// access, so a deny policy is never dropped because the database is down.
+func toolPolicies() ([]*pb.ToolPolicy, error) {
+	policyCacheMu.Lock()
+	defer policyCacheMu.Unlock()
+	if time.Since(policyCacheAt) < policyCacheTTL {
+		return policyCache, nil
+	}
+	policies, err := pb.ListToolPolicies()
+	if err != nil {
+		log.Errorf("Failed to load tool policies: %v", err)
+		return nil, err
+	}
+	policyCache, policyCacheAt = policies, time.Now()
+	return policyCache, nil
+}
+
+func invalidateToolPolicies() {
+	policyCacheMu.Lock()
+	policyCacheAt = time.Time{}
+	policyCacheMu.Unlock()
+}
+
+// toolServer returns the server a tool came from: "local" for built-in tools,
+// else the MCP server name.
+func toolServer(t *registeredTool) string {
+	if t.Source == "local" {
+		return "local"
+	}
+	_, name, _ := strings.Cut(t.Source, "/") // Source is serverKey(owner, name)
+	return name
+}
+
+// matchesToolTarget reports whether t matches a policy target: a tool name or
+// glob and/or a server name. An empty target matches nothing.
+func matchesToolTarget(toolPattern, server string, t *registeredTool) bool {
+	if server != "" && !strings.EqualFold(server, toolServer(t)) {
+		return false
+	}
+	if toolPattern != "" {
+		if ok, err := path.Match(toolPattern, t.Name); err != nil || !ok {
+			return false
+		}
+	}
+	return toolPattern != "" || server != ""
+}
+
+func policyMatchesTool(p *pb.ToolPolicy, t *registeredTool) bool {
+	return matchesToolTarget(p.Tool, p.Server, t)
+}
+
+func (c toolCaller) matchesSubject(p *pb.ToolPolicy) bool {
+	switch p.SubjectType {
+	case pb.PolicySubjectUser:
+		return p.SubjectID == c.userID
+	case pb.PolicySubjectRole:
+		return slices.Contains(c.roles, p.SubjectID)
+	case pb.PolicySubjectChannel:
+		return p.SubjectID == c.channelID
+	case pb.PolicySubjectGuild:
+		return c.guildID != "" && p.SubjectID == c.guildID
+	}
+	return false
+}
+
+// policyDecision reports whether any of policies allows or denies t for c.
+func policyDecision(policies []*pb.ToolPolicy, t *registeredTool, c toolCaller) (allowed, denied bool) {
+	for _, p := range policies {
+		if !c.matchesSubject(p) || !policyMatchesTool(p, t) {
+			continue
+		}
+		switch p.Effect {
+		case pb.PolicyDeny:
+			return false, true
+		case pb.PolicyAllow:
+			allowed = true
+		}
+	}
+	return allowed, false
+}
+
+// --- /tools policy ---
+
+var policyEffectChoices = []*discordgo.ApplicationCommandOptionChoice{
+	{Name: "allow", Value: pb.PolicyAllow},
+	{Name: "deny", Value: pb.PolicyDeny},
+}
+
+// HandleToolsCommand handles the /tools slash command.
+func HandleToolsCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	if len(data.Options) == 0 {
+		respondWithMessage(s, i, "Unknown tools subcommand.")
+		return
+	}
+	group := data.Options[0]
+	switch group.Name {
+	case "run":
+		handleToolRunCommand(s, i, group.Options)
+	case "policy":
+		handleToolPolicyCommand(s, i, group.Options)
+	case "approval":
+		handleApprovalPolicyCommand(s, i, group.Options)
+	default:
+		respondWithMessage(s, i, "Unknown tools subcommand.")
+	}
+}
+
+func handleToolPolicyCommand(s *discordgo.Session, i *discordgo.InteractionCreate, options []*discordgo.ApplicationCommandInteractionDataOption) {
+	var roles []string
+	if i.Member != nil {
+		roles = i.Member.Roles
+	}
+	caller := getUserID(i)
+	if !CheckAdmin(caller, roles) {
+		respondWithMessage(s, i, "You are not authorized to manage tool policies.")
+		return
+	}
+	if len(options) == 0 {
+		respondWithMessage(s, i, "Unknown policy subcommand.")
+		return
+	}
+	sub := options[0]
+	switch sub.Name {
+	case "add":
+		respondWithMessage(s, i, addToolPolicy(caller, sub.Options))
+	case "remove":
+		id := ""
+		for _, o := range sub.Options {
+			if o.Name == "id" {
+				id = o.StringValue()
+			}
+		}
+		if err := pb.DeleteToolPolicy(id); err != nil {
+			respondWithMessage(s, i, "Could not find that policy.")
+			return
+		}
+		invalidateToolPolicies()
+		respondWithMessage(s, i, fmt.Sprintf("Policy `%s` removed.", id))
+	case "list":
+		respondWithMessage(s, i, toolPolicyListReport())
+	default:
+		respondWithMessage(s, i, "Unknown policy subcommand.")
+	}
+}
+
+// addToolPolicy processes /tools policy add and returns the reply.
+func addToolPolicy(caller string, options []*discordgo.ApplicationCommandInteractionDataOption) string {
+	p := &pb.ToolPolicy{CreatedBy: caller}
+	subjects := 0
+	for _, o := range options {
+		switch o.Name {
+		case "effect":
+			p.Effect = o.StringValue()
+		case "tool":
+			p.Tool = strings.TrimSpace(o.StringValue())
+		case "server":
+			p.Server = strings.TrimSpace(o.StringValue())
+		case "role":
+			p.SubjectType, p.SubjectID = pb.PolicySubjectRole, o.RoleValue(nil, "").ID
+			subjects++
+		case "user":
+			p.SubjectType, p.SubjectID = pb.PolicySubjectUser, o.UserValue(nil).ID
+			subjects++
+		case "channel":
+			p.SubjectType, p.SubjectID = pb.PolicySubjectChannel, o.ChannelValue(nil).ID
+			subjects++
+		case "guild_id":
+			p.SubjectType, p.SubjectID = pb.PolicySubjectGuild, strings.TrimSpace(o.StringValue())
+			subjects++
+		}
+	}
+	if subjects != 1 || p.SubjectID == "" {
+		return "Give exactly one of `role`, `user`, `channel` or `guild_id`."
+	}
+	if p.Tool == "" && p.Server == "" {
+		return "Give a `tool` (name or glob like `ssh_*`) and/or a `server` (MCP server name, or `local` for built-in tools)."
+	}
+	if p.Tool != "" {
+		if _, err := path.Match(p.Tool, ""); err != nil {
+			return fmt.Sprintf("Invalid tool pattern %q.", p.Tool)
+		}
+	}
+	if err := pb.CreateToolPolicy(p); err != nil {
+		log.Errorf("Failed to create tool policy: %v", err)
+		return "Failed to save the policy. Please try again."
+	}
+	invalidateToolPolicies()
+	return "Policy added: " + describeToolPolicy(p)
+}
+
+func toolPolicyListReport() string {
+	policies, err := pb.ListToolPolicies()
+	if err != nil {
+		log.Errorf("Failed to list tool policies: %v", err)
+		return "Could not fetch tool policies. Please try again later."
+	}
+	if len(policies) == 0 {
+		return "No tool policies. Access follows tool visibility only."
+	}
+	var sb strings.Builder
+	sb.WriteString("**Tool policies** (deny wins):\n")
+	for _, p := range policies {
+		sb.WriteString("• " + describeToolPolicy(p) + "\n")
+	}
+	return truncateToLimit(sb.String(), discordMessageLimit)
+}
+
+func describeToolPolicy(p *pb.ToolPolicy) string {
+	var target []string
+	if p.Tool != "" {
+		target = append(target, fmt.Sprintf("tool `%s`", p.Tool))
+	}
+	if p.Server != "" {
+		target = append(target, fmt.Sprintf("server `%s`", p.Server))
+	}
+	var subject string
+	switch p.SubjectType {
+	case pb.PolicySubjectRole:
+		subject = "role <@&" + p.SubjectID + ">"
+	case pb.PolicySubjectUser:
+		subject = "user <@" + p.SubjectID + ">"
+	case pb.PolicySubjectChannel:
+		subject = "channel <#" + p.SubjectID + ">"
+	default:
+		subject = fmt.Sprintf("guild `%s`", p.SubjectID)
+	}
+	return fmt.Sprintf("`%s` — **%s** %s for %s", p.ID, p.Effect, strings.Join(target, " on "), subject)
+}
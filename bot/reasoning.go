@@ -0,0 +1,151 @@
+package bot
+
+import (
+	"bitbot/pb"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/charmbracelet/log"
+)
+
+// Reasoning models return their chain of thought alongside the reply. It is
+// never added to history; per channel it is either dropped (default), posted
+// after the reply inside a spoiler that anyone in the channel can open, or kept
+// behind a "Show reasoning" button that only admins can use. Reasoning can
+// quote tool arguments and results, so spoiler mode suits channels where
+// everyone may see those.
+
+// reasoningModeChoices are the selectable modes for /reasoning.
+var reasoningModeChoices = []*discordgo.ApplicationCommandOptionChoice{
+	{Name: "off — never show reasoning", Value: pb.ReasoningModeOff},
+	{Name: "spoiler — post it under a spoiler, readable by everyone in the channel", Value: pb.ReasoningModeSpoiler},
+	{Name: "button — admins can reveal it", Value: pb.ReasoningModeButton},
+}
+
+// maxStoredReasoning bounds how many replies' reasoning is kept in memory for
+// the "Show reasoning" button; older entries are evicted first.
+const maxStoredReasoning = 200
+
+var (
+	reasoningMu    sync.Mutex
+	reasoningStore = map[string]string{}
+	reasoningOrder []string
+	reasoningSeq   uint64
+)
+
+// storeReasoning keeps text for later reveal and returns its ID.
+func storeReasoning(text string) string {
+	reasoningMu.Lock()
+	defer reasoningMu.Unlock()
+	reasoningSeq++
+	id := fmt.Sprintf("%d", reasoningSeq)
+	reasoningStore[id] = text
+	reasoningOrder = append(reasoningOrder, id)
+	for len(reasoningOrder) > maxStoredReasoning {
+		delete(reasoningStore, reasoningOrder[0])
+		reasoningOrder = reasoningOrder[1:]
+	}
+	return id
+}
+
+func lookupReasoning(id string) (string, bool) {
+	reasoningMu.Lock()
+	defer reasoningMu.Unlock()
+	text, ok := reasoningStore[id]
+	return text, ok
+}
+
+// reasoningDisplay decides how a turn's reasoning is shown in channelID: in
+// button mode it adds a "Show reasoning" button to extras, and in spoiler mode
+// it returns a spoiler message to post after the reply. Nothing is added when
+// there is no reasoning or the channel has it off.
+func reasoningDisplay(extras *replyExtras, channelID string, reasoning []string) string {
+	if len(reasoning) == 0 {
+		return ""
+	}
+	mode, err := pb.GetReasoningMode(channelID)
+	if err != nil {
+		log.Warnf("Failed to load reasoning mode for channel %s: %v", channelID, err)
+		return ""
+	}
+	text := strings.Join(reasoning, "\n\n")
+	switch mode {
+	case pb.ReasoningModeSpoiler:
+		return reasoningSpoiler(text)
+	case pb.ReasoningModeButton:
+		id := storeReasoning(text)
+		extras.addRow(discordgo.Button{Label: "Show reasoning", Style: discordgo.SecondaryButton, CustomID: "reasoning_show_" + id, Emoji: &discordgo.ComponentEmoji{Name: "🧠"}})
+	}
+	return ""
+}
+
+// reasoningSpoiler wraps text in a spoiler that fits one Discord message. Any
+// "||" in the text would close the spoiler early, so it is broken up.
+func reasoningSpoiler(text string) string {
+	const header = "🧠 **Reasoning:**\n"
+	text = strings.ReplaceAll(text, "||", "| |")
+	notice := "\n… (truncated)"
+	limit := discordMessageLimit - utf8.RuneCountInString(header) - 4
+	if utf8.RuneCountInString(text) > limit {
+		text = truncateToLimit(text, limit-utf8.RuneCountInString(notice)) + notice
+	}
+	return header + "||" + text + "||"
+}
+
+// handleReasoningButton handles "Show reasoning" clicks. It reports whether
+// the interaction was a reasoning button.
+func handleReasoningButton(s *discordgo.Session, i *discordgo.InteractionCreate) bool {
+	customID := i.MessageComponentData().CustomID
+	if !strings.HasPrefix(customID, "reasoning_show_") {
+		return false
+	}
+	if !authorizeSSH(s, i.GuildID, getUserID(i)) {
+		respondWithMessage(s, i, "Only an admin can view the model's reasoning.")
+		return true
+	}
+	text, ok := lookupReasoning(strings.TrimPrefix(customID, "reasoning_show_"))
+	if !ok {
+		respondWithMessage(s, i, "This reasoning is no longer available.")
+		return true
+	}
+	respondWithMessage(s, i, truncateToLimit("🧠 **Reasoning:**\n"+text, discordMessageLimit))
+	return true
+}
+
+// HandleReasoningCommand handles /reasoning, which sets how model reasoning is
+// shown in the current channel. Admin only.
+func HandleReasoningCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if !authorizeSSH(s, i.GuildID, getUserID(i)) {
+		respondWithMessage(s, i, "You are not authorized to change reasoning display.")
+		return
+	}
+
+	mode := ""
+	for _, o := range i.ApplicationCommandData().Options {
+		if o.Name == "mode" {
+			mode = o.StringValue()
+		}
+	}
+	if mode == "" {
+		current, err := pb.GetReasoningMode(i.ChannelID)
+		if err != nil {
+			respondWithMessage(s, i, "Could not load this channel's reasoning setting.")
+			return
+		}
+		respondWithMessage(s, i, fmt.Sprintf("Reasoning display in this channel is `%s`.", current))
+		return
+	}
+	if err := pb.SetReasoningMode(i.ChannelID, mode); err != nil {
+		log.Errorf("Failed to set reasoning mode for channel %s: %v", i.ChannelID, err)
+		respondWithMessage(s, i, "Failed to save the reasoning setting. Please try again.")
+		return
+	}
+	msg := fmt.Sprintf("Reasoning display in this channel set to `%s`.", mode)
+	if mode == pb.ReasoningModeSpoiler {
+		msg += " Everyone in the channel can open the spoilers, including any tool arguments and results the reasoning quotes; use `button` to keep it to admins."
+	}
+	respondWithMessage(s, i, msg)
+}
@@ -13,6 +13,9 @@ import (
 // regoloEndpoint is the OpenAI-compatible chat completions endpoint for Regolo.ai.
 const regoloEndpoint = "https://api.regolo.ai/v1/chat/completions"
 
+// regoloEmbeddingsEndpoint is the OpenAI-compatible embeddings endpoint.
+const regoloEmbeddingsEndpoint = "https://api.regolo.ai/v1/embeddings"
+
 // ---- OpenAI-compatible request/response shapes (minimal subset) ----
 
 // Message is a single chat message in the OpenAI-compatible format.
@@ -22,6 +25,11 @@ type Message struct {
 	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
 	ToolCallID string     `json:"tool_call_id,omitempty"` // for role:"tool" replies
 	Name       string     `json:"name,omitempty"`         // tool name on the reply
+
+	// Local bookkeeping for user messages; never sent to the API.
+	speakerID  string // Discord ID of the user who wrote it
+	passive    bool   // observed in the channel rather than addressed to the bot
+	toolOutput bool   // the result of a tool call that finished outside a turn
 }
 
 // ToolCall represents a tool/function call requested by the model.
@@ -50,13 +58,39 @@ type chatRequest struct {
 	Model    string    `json:"model"`
 	Messages []Message `json:"messages"`
 	Tools    []Tool    `json:"tools,omitempty"`
+
+	// Optional limits, used for MCP sampling requests.
+	MaxTokens   int64    `json:"max_tokens,omitempty"`
+	Temperature float64  `json:"temperature,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+}
+
+// responseMessage is an assistant message as returned by the API. Reasoning
+// models (e.g. gpt-oss) return their chain of thought in a separate field; it
+// lives here rather than on Message so it is never sent back in history.
+type responseMessage struct {
+	Message
+	Reasoning        string `json:"reasoning,omitempty"`
+	ReasoningContent string `json:"reasoning_content,omitempty"` // alternate field name used by some servers
+}
+
+// reasoningText returns the model's reasoning for this message, if any.
+func (m responseMessage) reasoningText() string {
+	if m.Reasoning != "" {
+		return m.Reasoning
+	}
+	return m.ReasoningContent
 }
 
 type chatResponse struct {
 	Choices []struct {
-		Message      Message `json:"message"`
-		FinishReason string  `json:"finish_reason"`
+		Message      responseMessage `json:"message"`
+		FinishReason string          `json:"finish_reason"`
 	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
 	Error *struct {
 		Message string `json:"message"`
 		Type    string `json:"type"`
@@ -86,21 +120,80 @@ func initRegoloClient(apiKey, model string) error {
 // RegoloChat POSTs a chat completion request with the given messages and tools,
 // returning the parsed response.
 func RegoloChat(ctx context.Context, messages []Message, tools []Tool) (*chatResponse, error) {
+	return regoloComplete(ctx, chatRequest{
+		Messages: messages,
+		Tools:    tools,
+	})
+}
+
+// regoloComplete sends a chat completion request, filling in the configured
+// model.
+func regoloComplete(ctx context.Context, body chatRequest) (*chatResponse, error) {
 	if regoloAPIKey == "" {
 		return nil, fmt.Errorf("regolo client is not initialized")
 	}
+	body.Model = regoloModel
+	var parsed chatResponse
+	raw, err := regoloPost(ctx, regoloEndpoint, body, &parsed)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Error != nil {
+		return nil, fmt.Errorf("api error: %s (%s)", parsed.Error.Message, parsed.Error.Type)
+	}
+	if len(parsed.Choices) == 0 {
+		return nil, fmt.Errorf("no choices in response: %s", string(raw))
+	}
+	return &parsed, nil
+}
 
-	body := chatRequest{
-		Model:    regoloModel,
-		Messages: messages,
-		Tools:    tools,
+type embeddingsResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+	Error *struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
+
+// regoloEmbed returns an embedding for each input, computed with model.
+func regoloEmbed(ctx context.Context, model string, inputs []string) ([][]float64, error) {
+	if regoloAPIKey == "" {
+		return nil, fmt.Errorf("regolo client is not initialized")
+	}
+	var parsed embeddingsResponse
+	raw, err := regoloPost(ctx, regoloEmbeddingsEndpoint, map[string]any{"model": model, "input": inputs}, &parsed)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Error != nil {
+		return nil, fmt.Errorf("api error: %s (%s)", parsed.Error.Message, parsed.Error.Type)
+	}
+	out := make([][]float64, len(inputs))
+	for _, d := range parsed.Data {
+		if d.Index >= 0 && d.Index < len(out) {
+			out[d.Index] = d.Embedding
+		}
 	}
+	for _, e := range out {
+		if len(e) == 0 {
+			return nil, fmt.Errorf("missing embeddings in response: %s", string(raw))
+		}
+	}
+	return out, nil
+}
+
+// regoloPost POSTs body as JSON to a Regolo endpoint and decodes the response
+// into out, returning the raw response for error messages.
+func regoloPost(ctx context.Context, url string, body, out any) ([]byte, error) {
 	buf, err := json.Marshal(body)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", regoloEndpoint, bytes.NewReader(buf))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(buf))
 	if err != nil {
 		return nil, err
 	}
@@ -116,17 +209,10 @@ func RegoloChat(ctx context.Context, messages []Message, tools []Tool) (*chatRes
 	raw, _ := io.ReadAll(res.Body)
 
 	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP %d: %s", res.StatusCode, string(raw))
+		return raw, fmt.Errorf("HTTP %d: %s", res.StatusCode, string(raw))
 	}
-	var parsed chatResponse
-	if err := json.Unmarshal(raw, &parsed); err != nil {
-		return nil, fmt.Errorf("decode: %w (raw: %s)", err, string(raw))
+	if err := json.Unmarshal(raw, out); err != nil {
+		return raw, fmt.Errorf("decode: %w (raw: %s)", err, string(raw))
 	}
-	if parsed.Error != nil {
-		return nil, fmt.Errorf("api error: %s (%s)", parsed.Error.Message, parsed.Error.Type)
-	}
-	if len(parsed.Choices) == 0 {
-		return nil, fmt.Errorf("no choices in response: %s", string(raw))
-	}
-	return &parsed, nil
+	return raw, nil
 }
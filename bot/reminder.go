@@ -547,12 +547,31 @@ func parseWhenSimple(whenStr string) (time.Time, bool, string, error) {
 
 	// --- NEW: Support for recurring time formats like "every sunday 8pm" ---
 	if isRecurring {
-		// <weekday> <time> (after "every" has been removed)
-		recurringDayRe := regexp.MustCompile(`^([a-z]+) ([0-9:]+[ap]m|[0-9:]+)$`)
+		// <weekday> [at] <time> (after "every" has been removed)
+		recurringDayRe := regexp.MustCompile(`^([a-z]+) (?:at )?([0-9:]+[ap]m|[0-9:]+)$`)
 		if m := recurringDayRe.FindStringSubmatch(whenStr); len(m) == 3 {
 			weekdayStr := m[1]
 			timePart := m[2]
 
+			// "day" and "weekday(s)" are handled separately from named days.
+			if weekdayStr == "day" || weekdayStr == "weekday" || weekdayStr == "weekdays" {
+				t, err := parseTimeOfDay(timePart)
+				if err != nil {
+					return time.Time{}, false, "", fmt.Errorf("invalid time of day: %v", err)
+				}
+				reminderTime := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, reminderLocation)
+				if weekdayStr == "day" {
+					if !reminderTime.After(now) {
+						reminderTime = reminderTime.AddDate(0, 0, 1)
+					}
+					return reminderTime, true, "every day", nil
+				}
+				for !reminderTime.After(now) || isWeekend(reminderTime) {
+					reminderTime = reminderTime.AddDate(0, 0, 1)
+				}
+				return reminderTime, true, "every weekday", nil
+			}
+
 			// Parse the weekday
 			dayMap := map[string]time.Weekday{
 				"monday":    time.Monday,
@@ -799,6 +818,13 @@ func CalculateNextRecurrence(originalReminderTime time.Time, rule string, lastTr
 		}
 		return next, nil
 	}
+	if rule == "every weekday" {
+		next := time.Date(now.Year(), now.Month(), now.Day(), originalReminderTime.Hour(), originalReminderTime.Minute(), 0, 0, now.Location())
+		for !next.After(now) || isWeekend(next) {
+			next = next.AddDate(0, 0, 1)
+		}
+		return next, nil
+	}
 	if strings.HasPrefix(rule, "every ") {
 		dayPart := strings.TrimPrefix(rule, "every ")
 		dayMap := map[string]time.Weekday{
@@ -859,6 +885,11 @@ func CalculateNextRecurrence(originalReminderTime time.Time, rule string, lastTr
 	return time.Time{}, fmt.Errorf("unsupported recurrence rule for auto-calculation: '%s'", rule)
 }
 
+// isWeekend reports whether t falls on a Saturday or Sunday.
+func isWeekend(t time.Time) bool {
+	return t.Weekday() == time.Saturday || t.Weekday() == time.Sunday
+}
+
 // ButtonHandler handles reminder delete button interactions.
 func ButtonHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	if i.Type == discordgo.InteractionMessageComponent {
@@ -866,6 +897,18 @@ func ButtonHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		if handleToolbeltButton(s, i) {
 			return
 		}
+		if handleReasoningButton(s, i) {
+			return
+		}
+		if handleToolOutputButton(s, i) {
+			return
+		}
+		if handleElicitationButton(s, i) {
+			return
+		}
+		if handleSamplingButton(s, i) {
+			return
+		}
 		customID := i.MessageComponentData().CustomID
 		if strings.HasPrefix(customID, "reminder_delete_") {
 			reminderID := strings.TrimPrefix(customID, "reminder_delete_")
@@ -0,0 +1,242 @@
+package bot
+
+import (
+	"bitbot/pb"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/charmbracelet/log"
+)
+
+// Scheduled prompts run a stored prompt through the full chatbot tool loop on a
+// schedule, as the user who created it (so tool access is exactly theirs), and
+// post the reply to a channel. Schedules use the same "when" expressions as
+// reminders (e.g. "every weekday at 9am", "every 6h", "tomorrow at 8pm").
+
+// minScheduledPromptInterval is the shortest allowed gap between runs of a
+// recurring prompt; every run costs at least one model call.
+const minScheduledPromptInterval = 15 * time.Minute
+
+// HandleScheduleCommand handles the /schedule slash command.
+func HandleScheduleCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	if len(data.Options) == 0 {
+		respondWithMessage(s, i, "Unknown schedule subcommand.")
+		return
+	}
+	sub := data.Options[0]
+	switch sub.Name {
+	case "add":
+		handleAddScheduledPrompt(s, i, sub.Options)
+	case "list":
+		respondWithMessage(s, i, scheduledPromptListReport(getUserID(i)))
+	case "delete":
+		id := ""
+		for _, o := range sub.Options {
+			if o.Name == "id" {
+				id = o.StringValue()
+			}
+		}
+		respondWithMessage(s, i, deleteScheduledPromptFor(getUserID(i), id))
+	default:
+		respondWithMessage(s, i, "Unknown schedule subcommand.")
+	}
+}
+
+// handleAddScheduledPrompt processes /schedule add.
+func handleAddScheduledPrompt(s *discordgo.Session, i *discordgo.InteractionCreate, options []*discordgo.ApplicationCommandInteractionDataOption) {
+	var whenArg, promptArg string
+	channelID := i.ChannelID
+	for _, o := range options {
+		switch o.Name {
+		case "when":
+			whenArg = o.StringValue()
+		case "prompt":
+			promptArg = o.StringValue()
+		case "channel":
+			if ch := o.ChannelValue(s); ch != nil {
+				channelID = ch.ID
+			}
+		}
+	}
+	if strings.TrimSpace(whenArg) == "" || strings.TrimSpace(promptArg) == "" {
+		respondWithMessage(s, i, "`/schedule add` requires `when` and `prompt`.")
+		return
+	}
+	// The prompt runs on that channel's history and replies there, so the
+	// caller must be able to read and post in it.
+	if channelID != i.ChannelID && !canPost(s, getUserID(i), channelID) {
+		respondWithMessage(s, i, fmt.Sprintf("You can't post in <#%s>, so prompts can't be scheduled there.", channelID))
+		return
+	}
+
+	runTime, isRecurring, rule, err := parseWhenSimple(whenArg)
+	if err != nil {
+		respondWithMessage(s, i, fmt.Sprintf("Error parsing 'when': %v", err))
+		return
+	}
+	runTime = runTime.In(reminderLocation)
+	if isRecurring && recurrenceInterval(rule) < minScheduledPromptInterval {
+		respondWithMessage(s, i, fmt.Sprintf("Recurring prompts may run at most every %d minutes.", int(minScheduledPromptInterval.Minutes())))
+		return
+	}
+
+	sp := &pb.ScheduledPrompt{
+		UserID:         getUserID(i),
+		ChannelID:      channelID,
+		GuildID:        i.GuildID,
+		Prompt:         promptArg,
+		Schedule:       whenArg,
+		IsRecurring:    isRecurring,
+		RecurrenceRule: rule,
+		FirstRunTime:   runTime,
+		NextRunTime:    runTime,
+	}
+	if err := pb.CreateScheduledPrompt(sp); err != nil {
+		log.Errorf("Failed to create scheduled prompt: %v", err)
+		respondWithMessage(s, i, "Sorry, I couldn't save your scheduled prompt. Please try again later.")
+		return
+	}
+
+	msg := fmt.Sprintf("Scheduled prompt `%s` will first run on %s in <#%s>.", sp.ID, runTime.Format("Jan 2, 2006 at 15:04 (Europe/Zagreb)"), channelID)
+	if isRecurring {
+		msg += fmt.Sprintf(" It recurs %s.", rule)
+	}
+	respondWithMessage(s, i, msg)
+}
+
+// recurrenceInterval returns the fixed interval of an "every N minutes|hours|days"
+// rule. Calendar rules ("every day", "every weekday", "every monday") recur at
+// most daily, so they report 24h.
+func recurrenceInterval(rule string) time.Duration {
+	var n int
+	var unit string
+	if _, err := fmt.Sscanf(rule, "every %d %s", &n, &unit); err != nil {
+		return 24 * time.Hour
+	}
+	switch unit {
+	case "minutes":
+		return time.Duration(n) * time.Minute
+	case "hours":
+		return time.Duration(n) * time.Hour
+	default:
+		return time.Duration(n) * 24 * time.Hour
+	}
+}
+
+// scheduledPromptListReport lists the caller's scheduled prompts.
+func scheduledPromptListReport(userID string) string {
+	prompts, err := pb.ListScheduledPromptsByUser(userID)
+	if err != nil {
+		log.Errorf("Failed to list scheduled prompts for user %s: %v", userID, err)
+		return "Could not fetch your scheduled prompts. Please try again later."
+	}
+	if len(prompts) == 0 {
+		return "You have no scheduled prompts. Add one with `/schedule add when:<when> prompt:<prompt>`."
+	}
+	var sb strings.Builder
+	sb.WriteString("**Your scheduled prompts:**\n")
+	for _, p := range prompts {
+		next := "N/A"
+		if !p.NextRunTime.IsZero() {
+			next = p.NextRunTime.In(reminderLocation).Format("Jan 2, 2006 at 3:04 PM")
+		}
+		sb.WriteString(fmt.Sprintf("• `%s` — %s — <#%s> — next: %s\n  %s\n", p.ID, p.Schedule, p.ChannelID, next, truncateToLimit(p.Prompt, 200)))
+	}
+	return truncateToLimit(sb.String(), discordMessageLimit)
+}
+
+// deleteScheduledPromptFor deletes one of the caller's scheduled prompts.
+func deleteScheduledPromptFor(userID, id string) string {
+	if id == "" {
+		return "Missing scheduled prompt ID to delete."
+	}
+	p, err := pb.GetScheduledPromptByID(id)
+	if err != nil {
+		return "Could not find that scheduled prompt."
+	}
+	if p.UserID != userID {
+		return "You can only delete scheduled prompts you created."
+	}
+	if err := pb.DeleteScheduledPrompt(id); err != nil {
+		return "Failed to delete the scheduled prompt. Please try again."
+	}
+	return "Scheduled prompt deleted."
+}
+
+// StartPromptScheduler periodically runs due scheduled prompts.
+func StartPromptScheduler(s *discordgo.Session) {
+	log.Info("Starting scheduled prompt runner...")
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		processDueScheduledPrompts(s)
+	}
+}
+
+// processDueScheduledPrompts advances (or removes) each due prompt before
+// running it, so a slow or failing run is never picked up twice.
+func processDueScheduledPrompts(s *discordgo.Session) {
+	due, err := pb.GetDueScheduledPrompts()
+	if err != nil {
+		log.Errorf("Error fetching due scheduled prompts: %v", err)
+		return
+	}
+	for _, p := range due {
+		now := time.Now().In(reminderLocation)
+		if p.IsRecurring {
+			next, err := CalculateNextRecurrence(p.FirstRunTime, p.RecurrenceRule, p.NextRunTime)
+			if err != nil {
+				log.Errorf("Failed to calculate next run for scheduled prompt %s: %v. Deleting it to prevent a loop.", p.ID, err)
+				pb.DeleteScheduledPrompt(p.ID)
+				continue
+			}
+			if err := pb.UpdateScheduledPromptRun(p.ID, next, now); err != nil {
+				log.Errorf("Failed to update scheduled prompt %s: %v", p.ID, err)
+				continue
+			}
+		} else if err := pb.DeleteScheduledPrompt(p.ID); err != nil {
+			log.Errorf("Failed to delete one-shot scheduled prompt %s: %v", p.ID, err)
+			continue
+		}
+
+		log.Infof("Running scheduled prompt %s for user %s in channel %s", p.ID, p.UserID, p.ChannelID)
+		go runScheduledPrompt(s, p)
+	}
+}
+
+// runScheduledPrompt records the prompt as a message from its creator and runs
+// a normal chat turn for them, so tool authorization and history behave exactly
+// as if they had typed it.
+func runScheduledPrompt(s *discordgo.Session, p *pb.ScheduledPrompt) {
+	name := lookupDisplayName(s, p.GuildID, p.UserID) + " (scheduled)"
+	recordMessage(p.ChannelID, p.UserID, name, p.Prompt, true)
+	chatbot(s, p.UserID, p.ChannelID, p.GuildID)
+}
+
+// lookupDisplayName resolves a user's guild nickname, display name, or
+// username, falling back to "Unknown".
+func lookupDisplayName(s *discordgo.Session, guildID, userID string) string {
+	if guildID != "" {
+		if m, err := s.GuildMember(guildID, userID); err == nil {
+			if m.Nick != "" {
+				return m.Nick
+			}
+			if m.User != nil && m.User.GlobalName != "" {
+				return m.User.GlobalName
+			}
+			if m.User != nil {
+				return m.User.Username
+			}
+		}
+	}
+	if u, err := s.User(userID); err == nil {
+		if u.GlobalName != "" {
+			return u.GlobalName
+		}
+		return u.Username
+	}
+	return "Unknown"
+}
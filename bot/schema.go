@@ -0,0 +1,221 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Tool arguments are checked against the tool's JSON Schema before anything
+// runs, so a malformed call comes back to the model as a structured error it
+// can fix instead of reaching an MCP server or SSH with defaulted values.
+//
+// This is deliberately a small subset of JSON Schema — type, required, enum,
+// properties, additionalProperties:false and items — which covers what the
+// local tools and typical MCP servers declare. Unknown keywords are ignored, so
+// a schema the validator doesn't understand never blocks a call.
+
+// schemaError is one argument validation failure.
+type schemaError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// validateArgs checks args against schema and returns every violation found,
+// or nil if the arguments are valid (or there is no usable schema).
+func validateArgs(schema any, args map[string]any) []schemaError {
+	s := schemaMap(schema)
+	if s == nil {
+		return nil
+	}
+	var errs []schemaError
+	validateValue("", s, args, &errs)
+	return errs
+}
+
+// schemaMap normalizes a schema (a Go map literal such as the local tools use,
+// an SDK schema type, or raw JSON) to a generic JSON map by round-tripping it
+// through JSON, so e.g. []string "required" lists become []any.
+func schemaMap(schema any) map[string]any {
+	if schema == nil {
+		return nil
+	}
+	var raw []byte
+	switch v := schema.(type) {
+	case json.RawMessage:
+		raw = v
+	case []byte:
+		raw = v
+	default:
+		b, err := json.Marshal(schema)
+		if err != nil {
+			return nil
+		}
+		raw = b
+	}
+	var m map[string]any
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil
+	}
+	return m
+}
+
+func validateValue(path string, schema map[string]any, v any, errs *[]schemaError) {
+	add := func(format string, a ...any) {
+		*errs = append(*errs, schemaError{Path: displayPath(path), Message: fmt.Sprintf(format, a...)})
+	}
+
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		matched := false
+		for _, t := range types {
+			if jsonTypeMatches(t, v) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			add("expected %s, got %s", strings.Join(types, " or "), jsonTypeName(v))
+			return // nested checks would only add noise
+		}
+	}
+
+	if enum, ok := schema["enum"].([]any); ok && len(enum) > 0 {
+		found := false
+		for _, e := range enum {
+			if reflect.DeepEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			vals := make([]string, 0, len(enum))
+			for _, e := range enum {
+				b, _ := json.Marshal(e)
+				vals = append(vals, string(b))
+			}
+			add("must be one of %s", strings.Join(vals, ", "))
+		}
+	}
+
+	switch val := v.(type) {
+	case map[string]any:
+		props, _ := schema["properties"].(map[string]any)
+		if req, ok := schema["required"].([]any); ok {
+			for _, r := range req {
+				name, _ := r.(string)
+				if _, present := val[name]; name != "" && !present {
+					*errs = append(*errs, schemaError{Path: displayPath(joinPath(path, name)), Message: "required property is missing"})
+				}
+			}
+		}
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if ps, ok := props[k].(map[string]any); ok {
+				validateValue(joinPath(path, k), ps, val[k], errs)
+			} else if ap, ok := schema["additionalProperties"].(bool); ok && !ap {
+				*errs = append(*errs, schemaError{Path: displayPath(joinPath(path, k)), Message: "unknown property"})
+			}
+		}
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for idx, item := range val {
+				validateValue(fmt.Sprintf("%s[%d]", path, idx), items, item, errs)
+			}
+		}
+	}
+}
+
+func schemaTypes(t any) []string {
+	switch v := t.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, x := range v {
+			if s, ok := x.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func jsonTypeMatches(t string, v any) bool {
+	switch t {
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "null":
+		return v == nil
+	}
+	return true // unknown type keyword: don't block the call
+}
+
+func jsonTypeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func joinPath(base, key string) string {
+	if base == "" {
+		return key
+	}
+	return base + "." + key
+}
+
+func displayPath(p string) string {
+	if p == "" {
+		return "(root)"
+	}
+	return p
+}
+
+// validationResult is the tool result returned to the model when arguments
+// fail validation.
+func validationResult(tool string, errs []schemaError) string {
+	b, err := json.Marshal(map[string]any{
+		"status":  "error",
+		"message": fmt.Sprintf("invalid arguments for %q; fix them and call the tool again", tool),
+		"errors":  errs,
+	})
+	if err != nil {
+		return jsonResult("error", fmt.Sprintf("invalid arguments for %q", tool))
+	}
+	return string(b)
+}
@@ -0,0 +1,57 @@
+package bot
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestValidateArgs checks argument validation against the real reminder
+// schema (a Go map literal) and a JSON schema shaped like an MCP server's.
+func TestValidateArgs(t *testing.T) {
+	reminder := topLevelToolSchema("add_reminder")
+	if reminder == nil {
+		t.Fatal("add_reminder schema not found")
+	}
+
+	errs := validateArgs(reminder, map[string]any{"who": "@me", "when": "in 10m", "message": "tea"})
+	if len(errs) != 0 {
+		t.Errorf("valid reminder args rejected: %v", errs)
+	}
+
+	errs = validateArgs(reminder, map[string]any{"who": "@me", "when": 10.0})
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors (missing message, wrong type for when), got %v", errs)
+	}
+
+	var mcpSchema any
+	_ = json.Unmarshal([]byte(`{
+		"type": "object",
+		"additionalProperties": false,
+		"required": ["mode"],
+		"properties": {
+			"mode":  {"type": "string", "enum": ["full", "incremental"]},
+			"count": {"type": "integer"},
+			"tags":  {"type": "array", "items": {"type": "string"}}
+		}
+	}`), &mcpSchema)
+
+	errs = validateArgs(mcpSchema, map[string]any{"mode": "full", "count": 3.0, "tags": []any{"a"}})
+	if len(errs) != 0 {
+		t.Errorf("valid MCP args rejected: %v", errs)
+	}
+
+	errs = validateArgs(mcpSchema, map[string]any{"mode": "weekly", "count": 1.5, "tags": []any{"a", 2.0}, "extra": true})
+	want := map[string]bool{"count": true, "extra": true, "mode": true, "tags[1]": true}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, got %v", len(want), errs)
+	}
+	for _, e := range errs {
+		if !want[e.Path] {
+			t.Errorf("unexpected error path %q (%s)", e.Path, e.Message)
+		}
+	}
+
+	if errs := validateArgs(nil, map[string]any{"anything": 1.0}); errs != nil {
+		t.Errorf("nil schema should accept anything, got %v", errs)
+	}
+}
@@ -0,0 +1,193 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/charmbracelet/log"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// MCP tools can return images and files (charts, screenshots, exports) besides
+// text. Those are uploaded as attachments on the message that reports the
+// result, and the model gets a short reference in their place, since it can't
+// see them. Only allowed MIME types within the size limits are forwarded.
+
+const (
+	// maxAttachmentSize is the largest single file forwarded, and
+	// maxAttachmentTotal the most forwarded per message, within Discord's
+	// upload limit.
+	maxAttachmentSize  = 8 << 20
+	maxAttachmentTotal = 8 << 20
+	// maxAttachments is Discord's limit of files per message.
+	maxAttachments = 10
+)
+
+// attachmentTypes are the MIME types forwarded to Discord.
+var attachmentTypes = map[string]bool{
+	"image/png":        true,
+	"image/jpeg":       true,
+	"image/gif":        true,
+	"image/webp":       true,
+	"application/pdf":  true,
+	"application/json": true,
+	"text/plain":       true,
+	"text/csv":         true,
+	"text/markdown":    true,
+	"text/html":        true,
+}
+
+// toolAttachments collects the files tools produce while a result is being
+// built (e.g. during one chat turn).
+type toolAttachments struct {
+	mu    sync.Mutex
+	files []*discordgo.File
+	size  int
+}
+
+type toolAttachmentsKey struct{}
+
+// withToolAttachments returns a context whose tool calls add their files to a.
+func withToolAttachments(ctx context.Context, a *toolAttachments) context.Context {
+	return context.WithValue(ctx, toolAttachmentsKey{}, a)
+}
+
+// add attaches a file produced by tool and returns its name, or why it was
+// not attached.
+func (a *toolAttachments) add(tool, uri, mimeType string, data []byte) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	name := attachmentName(tool, uri, mimeType, len(a.files)+1)
+	switch {
+	case !attachmentTypes[mimeType]:
+		return name, fmt.Errorf("type %s is not forwarded", mimeType)
+	case len(data) > maxAttachmentSize:
+		return name, fmt.Errorf("it is over the %s limit", formatSize(maxAttachmentSize))
+	case len(a.files) >= maxAttachments || a.size+len(data) > maxAttachmentTotal:
+		return name, fmt.Errorf("the reply already has as many attachments as it can hold")
+	}
+	a.files = append(a.files, &discordgo.File{Name: name, ContentType: mimeType, Reader: bytes.NewReader(data)})
+	a.size += len(data)
+	return name, nil
+}
+
+// take returns the collected files; later calls return none, as a file's
+// reader can only be sent once.
+func (a *toolAttachments) take() []*discordgo.File {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	files := a.files
+	a.files, a.size = nil, 0
+	return files
+}
+
+// absorb moves b's files into a, as far as they fit, e.g. once a call that
+// collected its own files finishes within the chat turn.
+func (a *toolAttachments) absorb(b *toolAttachments) {
+	files := b.take()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, f := range files {
+		size := int(f.Reader.(*bytes.Reader).Size())
+		if len(a.files) >= maxAttachments || a.size+size > maxAttachmentTotal {
+			log.Warnf("Dropped attachment %s: the reply is full", f.Name)
+			continue
+		}
+		a.files = append(a.files, f)
+		a.size += size
+	}
+}
+
+// forwardMCPContent attaches a non-text content block to the reply when it
+// can and returns the reference the model sees in its place.
+func forwardMCPContent(ctx context.Context, tool string, c mcp.Content) string {
+	var uri, mimeType, text string
+	var data []byte
+	switch c := c.(type) {
+	case *mcp.ImageContent:
+		mimeType, data = c.MIMEType, c.Data
+	case *mcp.AudioContent:
+		mimeType, data = c.MIMEType, c.Data
+	case *mcp.EmbeddedResource:
+		if c.Resource == nil {
+			return ""
+		}
+		uri, mimeType = c.Resource.URI, c.Resource.MIMEType
+		if c.Resource.Blob != nil {
+			data = c.Resource.Blob
+		} else {
+			text, data = c.Resource.Text, []byte(c.Resource.Text)
+			if mimeType == "" {
+				mimeType = "text/plain"
+			}
+		}
+	case *mcp.ResourceLink:
+		return fmt.Sprintf("[resource link: %s]", c.URI)
+	default:
+		return ""
+	}
+	mimeType, _, _ = mime.ParseMediaType(mimeType)
+
+	var ref string
+	if a, _ := ctx.Value(toolAttachmentsKey{}).(*toolAttachments); a == nil {
+		ref = fmt.Sprintf("[%s content (%s, %s) was not forwarded]", mimeType, formatSize(len(data)), describeURI(uri))
+	} else if name, err := a.add(tool, uri, mimeType, data); err != nil {
+		ref = fmt.Sprintf("[%s (%s) was not attached: %v]", name, formatSize(len(data)), err)
+	} else {
+		ref = fmt.Sprintf("[%s (%s, %s) is attached to your reply for the user to see]", name, mimeType, formatSize(len(data)))
+	}
+	if text != "" {
+		// The model can still read a text resource.
+		ref += "\n" + text
+	}
+	return ref
+}
+
+// attachmentName names a forwarded file after its resource URI, or after the
+// tool that produced it.
+func attachmentName(tool, uri, mimeType string, n int) string {
+	if uri != "" {
+		if base := path.Base(uri); base != "" && base != "." && base != "/" && strings.Contains(base, ".") {
+			return base
+		}
+	}
+	ext := ".bin"
+	if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+		ext = exts[0]
+	}
+	switch mimeType {
+	case "image/jpeg":
+		ext = ".jpg"
+	case "text/plain":
+		ext = ".txt"
+	}
+	return fmt.Sprintf("%s-%d%s", tool, n, ext)
+}
+
+func describeURI(uri string) string {
+	if uri == "" {
+		return "inline"
+	}
+	return uri
+}
+
+// formatSize renders a byte count for people.
+func formatSize(n int) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%d KB", n>>10)
+	default:
+		return fmt.Sprintf("%d bytes", n)
+	}
+}
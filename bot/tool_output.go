@@ -0,0 +1,226 @@
+package bot
+
+import (
+	"bitbot/pb"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/charmbracelet/log"
+)
+
+// Large tool results (SSH output, MCP payloads) are stored out-of-band in the
+// tool_outputs collection. History only gets a head/tail preview and an
+// output_id; the model pages through the rest with read_tool_output, and users
+// can download the full result from a button on the reply.
+
+const (
+	// maxInlineToolResult is the largest result (in characters) kept in history
+	// as-is.
+	maxInlineToolResult = 8000
+	previewHeadChars    = 1500
+	previewTailChars    = 1000
+
+	defaultOutputPage = 4000
+	maxOutputPage     = 6000 // stays under maxInlineToolResult once JSON-encoded
+
+	// toolOutputRetention is how long stored outputs are kept.
+	toolOutputRetention = 7 * 24 * time.Hour
+
+	// maxOutputButtons caps the download buttons on one reply (one action row).
+	maxOutputButtons = 4
+)
+
+// offloadToolResult returns result unchanged if it is small enough for
+// history. Otherwise it stores the full result and returns a preview with a
+// handle the model can page through, recording the output on turn so the reply
+// can offer it as a download.
+func offloadToolResult(userID, channelID, tool, result string, turn *chatTurn) string {
+	chars := utf8.RuneCountInString(result)
+	if chars <= maxInlineToolResult {
+		return result
+	}
+
+	stored := result
+	clipped := false
+	if len(stored) > pb.MaxToolOutputSize {
+		stored = strings.ToValidUTF8(stored[:pb.MaxToolOutputSize], "")
+		chars = utf8.RuneCountInString(stored)
+		clipped = true
+	}
+	out, err := pb.SaveToolOutput(userID, channelID, tool, stored, chars)
+	if err != nil {
+		log.Errorf("Failed to store large output of %s: %v", tool, err)
+		return jsonResult("success", truncateToLimit(result, maxInlineToolResult-100)+"\n… (output truncated; it could not be stored for paging)")
+	}
+	if turn != nil {
+		turn.outputs = append(turn.outputs, out.ID)
+	}
+
+	runes := []rune(stored)
+	msg := fmt.Sprintf("The result is %d characters, too large to include. Only the beginning and end are shown. Page through the rest with call_tool name=local/read_tool_output arguments={\"output_id\":%q,\"offset\":%d}; the user can also download the full result.", chars, out.ID, previewHeadChars)
+	if clipped {
+		msg += fmt.Sprintf(" The stored copy was cut to the first %d bytes.", pb.MaxToolOutputSize)
+	}
+	b, err := json.Marshal(map[string]any{
+		"status":       "success",
+		"message":      msg,
+		"output_id":    out.ID,
+		"total_chars":  chars,
+		"preview_head": string(runes[:previewHeadChars]),
+		"preview_tail": string(runes[len(runes)-previewTailChars:]),
+	})
+	if err != nil {
+		return jsonResult("success", msg)
+	}
+	return string(b)
+}
+
+// canReadToolOutput reports whether userID may read a stored output: the user
+// whose call produced it, or an admin.
+func canReadToolOutput(out *pb.ToolOutput, userID string, isAdmin bool) bool {
+	return isAdmin || out.UserID == userID
+}
+
+// registerToolOutputTools registers read_tool_output as a local, public
+// toolbelt tool; access to each output is checked against its owner.
+func registerToolOutputTools() {
+	registerTool(&registeredTool{
+		Name:        "read_tool_output",
+		Description: "Read a page of a large tool result that was stored out-of-band (the result returned an output_id and a preview). Returns up to 'limit' characters starting at 'offset', plus next_offset when more remains.",
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"output_id": map[string]any{"type": "string", "description": "The output_id from the truncated result."},
+				"offset":    map[string]any{"type": "integer", "description": "Character offset to start reading from (default 0)."},
+				"limit":     map[string]any{"type": "integer", "description": fmt.Sprintf("Maximum characters to return (default %d, max %d).", defaultOutputPage, maxOutputPage)},
+			},
+			"required": []string{"output_id"},
+		},
+		Source:     "local",
+		Visibility: pb.MCPVisibilityPublic,
+		Invoke: func(ctx context.Context, userID, channelID, guildID string, args map[string]any) (string, error) {
+			return readToolOutputPage(newToolCaller(botSession.Load(), userID, channelID, guildID), args), nil
+		},
+	})
+}
+
+// readToolOutputPage serves one page of a stored output to the model. Admins,
+// including role-based ones, may read anyone's, as with the download button.
+func readToolOutputPage(c toolCaller, args map[string]any) string {
+	id := getStr(args, "output_id")
+	out, err := pb.GetToolOutput(id)
+	if err != nil || !canReadToolOutput(out, c.userID, c.isAdmin) {
+		return jsonResult("error", fmt.Sprintf("no stored output %q is available to you", id))
+	}
+	content, err := pb.ReadToolOutput(id)
+	if err != nil {
+		log.Errorf("Failed to read tool output %s: %v", id, err)
+		return jsonResult("error", "failed to read the stored output")
+	}
+
+	offset := 0
+	if f, ok := args["offset"].(float64); ok && f > 0 {
+		offset = int(f)
+	}
+	limit := defaultOutputPage
+	if f, ok := args["limit"].(float64); ok && f > 0 {
+		limit = min(int(f), maxOutputPage)
+	}
+	runes := []rune(content)
+	if offset > len(runes) {
+		offset = len(runes)
+	}
+	end := min(offset+limit, len(runes))
+
+	page := map[string]any{
+		"status":      "success",
+		"output_id":   id,
+		"offset":      offset,
+		"total_chars": len(runes),
+		"content":     string(runes[offset:end]),
+	}
+	if end < len(runes) {
+		page["next_offset"] = end
+	}
+	b, err := json.Marshal(page)
+	if err != nil {
+		return jsonResult("error", "failed to encode the page")
+	}
+	return string(b)
+}
+
+// addToolOutputButtons adds a download button to extras for each stored output.
+func addToolOutputButtons(extras *replyExtras, ids []string) {
+	var buttons []discordgo.MessageComponent
+	for n, id := range ids {
+		if n == maxOutputButtons {
+			break
+		}
+		label := "Download full result"
+		if len(ids) > 1 {
+			label = fmt.Sprintf("Download result %d", n+1)
+		}
+		buttons = append(buttons, discordgo.Button{Label: label, Style: discordgo.SecondaryButton, CustomID: "tool_output_" + id, Emoji: &discordgo.ComponentEmoji{Name: "📄"}})
+	}
+	extras.addRow(buttons...)
+}
+
+// handleToolOutputButton sends a stored output as an ephemeral attachment to
+// whoever may read it. It reports whether the interaction was a download button.
+func handleToolOutputButton(s *discordgo.Session, i *discordgo.InteractionCreate) bool {
+	customID := i.MessageComponentData().CustomID
+	if !strings.HasPrefix(customID, "tool_output_") {
+		return false
+	}
+	id := strings.TrimPrefix(customID, "tool_output_")
+	userID := getUserID(i)
+	out, err := pb.GetToolOutput(id)
+	if err != nil {
+		respondWithMessage(s, i, "This result is no longer available.")
+		return true
+	}
+	if !canReadToolOutput(out, userID, authorizeSSH(s, i.GuildID, userID)) {
+		respondWithMessage(s, i, "Only the person who ran the tool, or an admin, can download this result.")
+		return true
+	}
+	content, err := pb.ReadToolOutput(id)
+	if err != nil {
+		log.Errorf("Failed to read tool output %s: %v", id, err)
+		respondWithMessage(s, i, "Failed to read the stored result. Please try again.")
+		return true
+	}
+	respondWithMessage(s, i, &discordgo.MessageSend{
+		Content: fmt.Sprintf("📄 Full result of `%s` (%d characters):", out.Tool, out.Chars),
+		Files:   []*discordgo.File{textAttachment(out.Tool, content)},
+	})
+	return true
+}
+
+// textAttachment wraps content as a .txt file named after the tool.
+func textAttachment(tool, content string) *discordgo.File {
+	return &discordgo.File{
+		Name:        tool + "-output.txt",
+		ContentType: "text/plain; charset=utf-8",
+		Reader:      strings.NewReader(content),
+	}
+}
+
+// StartToolOutputCleanup periodically deletes stored outputs older than
+// toolOutputRetention.
+func StartToolOutputCleanup() {
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+	for range ticker.C {
+		n, err := pb.DeleteToolOutputsBefore(time.Now().Add(-toolOutputRetention))
+		if err != nil {
+			log.Errorf("Failed to clean up old tool outputs: %v", err)
+		} else if n > 0 {
+			log.Infof("Deleted %d expired tool outputs", n)
+		}
+	}
+}
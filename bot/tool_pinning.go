@@ -0,0 +1,162 @@
+package bot
+
+import (
+	"bitbot/pb"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// Reaching a toolbelt tool costs a find_tools round before call_tool. So each
+// user's most-used tools (counted per user and channel in tool_usage) are also
+// offered to the model directly, as first-class tools with their real schemas,
+// as far as their definitions fit in TOOL_PIN_TOKEN_BUDGET. A call of a pinned
+// tool goes through call_tool, so access checks, confirmation and approval
+// policies still apply.
+
+const (
+	defaultPinTokenBudget = 1500
+	maxPinnedTools        = 8
+	// pinUsageWindow is how far back tool use counts.
+	pinUsageWindow = 30 * 24 * time.Hour
+)
+
+// pinTokenBudget is roughly how many tokens pinned tool definitions may add to
+// each request; 0 turns pinning off.
+func pinTokenBudget() int {
+	v := strings.TrimSpace(os.Getenv("TOOL_PIN_TOKEN_BUDGET"))
+	if v == "" {
+		return defaultPinTokenBudget
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		log.Warnf("Invalid TOOL_PIN_TOKEN_BUDGET %q, using %d", v, defaultPinTokenBudget)
+		return defaultPinTokenBudget
+	}
+	return n
+}
+
+// usageScores weighs tool use by qualified tool name: the user's own use in
+// this channel counts most, their use elsewhere less, and other users' use in
+// this channel least.
+func usageScores(uses []*pb.ToolUse, userID, channelID string) map[string]float64 {
+	scores := map[string]float64{}
+	for _, u := range uses {
+		weight := 1.0
+		switch {
+		case u.UserID == userID && u.ChannelID == channelID:
+			weight = 2
+		case u.UserID != userID:
+			weight = 0.5
+		}
+		scores[u.Server+"/"+u.Tool] += weight * float64(u.Uses)
+	}
+	return scores
+}
+
+// pinnedTools returns function tools for the caller's most-used toolbelt
+// tools, and the owner-qualified name of the tool each one calls. taken are the
+// tools already offered, whose names pinned tools must not reuse.
+func pinnedTools(c toolCaller, taken []Tool) ([]Tool, map[string]string) {
+	budget := pinTokenBudget()
+	if budget <= 0 {
+		return nil, nil
+	}
+	uses, err := pb.ListToolUses(c.userID, c.channelID, time.Now().Add(-pinUsageWindow))
+	if err != nil {
+		log.Warnf("Failed to load tool usage for pinning: %v", err)
+		return nil, nil
+	}
+	scores := usageScores(uses, c.userID, c.channelID)
+	names := make([]string, 0, len(scores))
+	for name := range scores {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if scores[names[i]] != scores[names[j]] {
+			return scores[names[i]] > scores[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	used := map[string]bool{}
+	for _, t := range taken {
+		used[t.Function.Name] = true
+	}
+	var tools []Tool
+	calls := map[string]string{}
+	for _, name := range names {
+		if len(tools) >= maxPinnedTools {
+			break
+		}
+		t, err := resolveAccessibleTool(c, name)
+		if err != nil || t == nil {
+			continue // no longer available, or ambiguous
+		}
+		fn := pinnedFunctionName(t)
+		if used[fn] {
+			continue
+		}
+		tool := Tool{Type: "function", Function: functionSpec{
+			Name:        fn,
+			Description: pinnedDescription(t),
+			Parameters:  pinnedParameters(t),
+		}}
+		cost := estimateToolTokens(tool)
+		if cost > budget {
+			continue // a smaller one may still fit
+		}
+		budget -= cost
+		used[fn] = true
+		tools = append(tools, tool)
+		calls[fn] = ownerQualifiedName(t)
+	}
+	return tools, calls
+}
+
+var functionNameInvalid = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// pinnedFunctionName turns a qualified tool name into a valid function name,
+// e.g. "backups/run_backup" into "backups__run_backup".
+func pinnedFunctionName(t *registeredTool) string {
+	name := functionNameInvalid.ReplaceAllString(toolServer(t), "_") + "__" + functionNameInvalid.ReplaceAllString(t.Name, "_")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+func pinnedDescription(t *registeredTool) string {
+	desc := fmt.Sprintf("[toolbelt tool %s, offered directly because it is used often] %s", qualifiedName(t), t.Description)
+	if t.Destructive {
+		desc += " Destructive: the user must confirm it before it runs."
+	}
+	return desc
+}
+
+// pinnedParameters returns t's input schema as a function's parameters.
+func pinnedParameters(t *registeredTool) any {
+	m := schemaMap(t.InputSchema)
+	if m == nil || m["type"] != "object" {
+		return map[string]any{"type": "object", "properties": map[string]any{}}
+	}
+	delete(m, "$schema")
+	return m
+}
+
+// estimateToolTokens estimates a tool definition's size in tokens, at about
+// four characters a token.
+func estimateToolTokens(t Tool) int {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return 0
+	}
+	return (len(b) + 3) / 4
+}
@@ -0,0 +1,54 @@
+package bot
+
+import (
+	"bitbot/pb"
+	"strings"
+	"testing"
+)
+
+// TestUsageScores checks how use is weighed: the caller's own use in the
+// channel counts most, their use elsewhere less, other users' use least.
+func TestUsageScores(t *testing.T) {
+	uses := []*pb.ToolUse{
+		{UserID: "u1", ChannelID: "c1", Server: "backups", Tool: "run_backup", Uses: 3},
+		{UserID: "u1", ChannelID: "c2", Server: "backups", Tool: "run_backup", Uses: 2},
+		{UserID: "u2", ChannelID: "c1", Server: "local", Tool: "execute_ssh_command", Uses: 10},
+		{UserID: "u1", ChannelID: "c2", Server: "local", Tool: "list_ssh_servers", Uses: 4},
+	}
+	got := usageScores(uses, "u1", "c1")
+	want := map[string]float64{
+		"backups/run_backup":        3*2 + 2*1,
+		"local/execute_ssh_command": 10 * 0.5,
+		"local/list_ssh_servers":    4,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("usageScores = %v, want %v", got, want)
+	}
+	for name, score := range want {
+		if got[name] != score {
+			t.Errorf("score of %s = %v, want %v", name, got[name], score)
+		}
+	}
+}
+
+// TestPinnedFunctionName checks that pinned tools get valid function names.
+func TestPinnedFunctionName(t *testing.T) {
+	tests := []struct {
+		tool *registeredTool
+		want string
+	}{
+		{&registeredTool{Name: "execute_ssh_command", Source: "local"}, "local__execute_ssh_command"},
+		{&registeredTool{Name: "run_backup", Source: serverKey("u1", "backups")}, "backups__run_backup"},
+		{&registeredTool{Name: "get.status", Source: serverKey("u1", "my server")}, "my_server__get_status"},
+	}
+	for _, tc := range tests {
+		if got := pinnedFunctionName(tc.tool); got != tc.want {
+			t.Errorf("pinnedFunctionName(%s) = %q, want %q", qualifiedName(tc.tool), got, tc.want)
+		}
+	}
+
+	long := &registeredTool{Name: strings.Repeat("x", 80), Source: "local"}
+	if got := pinnedFunctionName(long); len(got) != 64 {
+		t.Errorf("pinnedFunctionName of a long name has %d characters, want 64", len(got))
+	}
+}
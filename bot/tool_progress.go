@@ -0,0 +1,332 @@
+package bot
+
+import (
+	"bitbot/pb"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/charmbracelet/log"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Tools can take minutes (backups, exports). A call may run until its timeout:
+// the tool's or its server's, set with /mcp timeout, else defaultToolTimeout.
+// Progress notifications an MCP server sends meanwhile are shown in a status
+// message in the channel, edited as they arrive. A chat turn waits at most
+// toolTurnWait for a result; a call still running then continues in the
+// background and its result is posted in the channel when it finishes.
+
+const (
+	defaultToolTimeout = 60 * time.Second
+	// maxToolTimeout bounds the timeouts /mcp timeout can set.
+	maxToolTimeout = 6 * time.Hour
+	toolTurnWait   = 60 * time.Second
+	// progressEditInterval spaces out edits of a status message, within
+	// Discord's rate limits.
+	progressEditInterval = 2 * time.Second
+)
+
+// minToolTimeoutSeconds is the lower bound of the /mcp timeout "seconds"
+// option; 0 clears a timeout.
+var minToolTimeoutSeconds = 0.0
+
+// toolTimeout is how long a call of t may run.
+func toolTimeout(t *registeredTool) time.Duration {
+	if t.Timeout <= 0 {
+		return defaultToolTimeout
+	}
+	return min(t.Timeout, maxToolTimeout)
+}
+
+// formatDuration renders a duration for people, e.g. "90s" as "1m30s" and an
+// hour as "1h".
+func formatDuration(d time.Duration) string {
+	s := d.Round(time.Second).String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
+
+// toolProgress is the status message of one tool call. Nothing is posted
+// until the server reports progress or the call moves to the background.
+type toolProgress struct {
+	s         *discordgo.Session
+	channelID string
+	tool      string
+	start     time.Time
+
+	mu          sync.Mutex
+	msgID       string
+	status      string // latest progress, e.g. "40/100 (40%) — copying files"
+	background  bool
+	lastEdit    time.Time
+	flushQueued bool
+	done        bool
+}
+
+type toolProgressKey struct{}
+
+func newToolProgress(s *discordgo.Session, channelID, tool string) *toolProgress {
+	return &toolProgress{s: s, channelID: channelID, tool: tool, start: time.Now()}
+}
+
+// withToolProgress returns a context whose MCP tool calls report progress to p.
+func withToolProgress(ctx context.Context, p *toolProgress) context.Context {
+	return context.WithValue(ctx, toolProgressKey{}, p)
+}
+
+// update records a progress notification; it is shown by the next edit.
+func (p *toolProgress) update(n *mcp.ProgressNotificationParams) {
+	status := formatProgress(n)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status = status
+	p.queueFlushLocked()
+}
+
+// toBackground notes that the call continues past the chat turn.
+func (p *toolProgress) toBackground() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.background = true
+	p.queueFlushLocked()
+}
+
+// queueFlushLocked schedules an edit of the status message, no sooner than
+// progressEditInterval after the last one. Edits happen off the caller's
+// goroutine, since progress is delivered on the session's read loop.
+func (p *toolProgress) queueFlushLocked() {
+	if p.done || p.flushQueued {
+		return
+	}
+	p.flushQueued = true
+	time.AfterFunc(max(0, progressEditInterval-time.Since(p.lastEdit)), func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.flushQueued = false
+		if !p.done {
+			p.writeLocked(p.text())
+		}
+	})
+}
+
+func (p *toolProgress) text() string {
+	text := fmt.Sprintf("⏳ `%s` is running (%s)", p.tool, formatDuration(time.Since(p.start)))
+	if p.status != "" {
+		text += ": " + p.status
+	}
+	if p.background {
+		text += "\nIt continues in the background; the result will be posted here when it finishes."
+	}
+	return truncateToLimit(text, discordMessageLimit)
+}
+
+// writeLocked posts the status message, or edits it once posted.
+func (p *toolProgress) writeLocked(content string) {
+	p.lastEdit = time.Now()
+	if p.msgID == "" {
+		msg, err := p.s.ChannelMessageSendComplex(p.channelID, &discordgo.MessageSend{
+			Content:         content,
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		})
+		if err != nil {
+			log.Warnf("Failed to post progress of %s: %v", p.tool, err)
+			return
+		}
+		p.msgID = msg.ID
+		return
+	}
+	if _, err := p.s.ChannelMessageEdit(p.channelID, p.msgID, content); err != nil {
+		log.Warnf("Failed to update progress of %s: %v", p.tool, err)
+	}
+}
+
+// finish replaces the status message, if one was posted, with the outcome.
+func (p *toolProgress) finish(ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done = true
+	if p.msgID == "" {
+		return
+	}
+	outcome := fmt.Sprintf("✅ `%s` finished after %s.", p.tool, formatDuration(time.Since(p.start)))
+	if !ok {
+		outcome = fmt.Sprintf("⚠️ `%s` failed after %s.", p.tool, formatDuration(time.Since(p.start)))
+	}
+	p.writeLocked(outcome)
+}
+
+// formatProgress renders a progress notification, e.g. "40/100 (40%) —
+// copying files".
+func formatProgress(n *mcp.ProgressNotificationParams) string {
+	num := func(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
+	var parts []string
+	if n.Total > 0 {
+		parts = append(parts, fmt.Sprintf("%s/%s (%d%%)", num(n.Progress), num(n.Total), int(100*n.Progress/n.Total)))
+	} else if n.Message == "" {
+		parts = append(parts, num(n.Progress)+" so far")
+	}
+	if n.Message != "" {
+		parts = append(parts, n.Message)
+	}
+	return strings.Join(parts, " — ")
+}
+
+var (
+	// progressTokens maps the progress token of each call in flight to its
+	// status message.
+	progressTokens   = map[string]*toolProgress{}
+	progressTokensMu sync.Mutex
+)
+
+// watchProgress asks the server for progress notifications on a call when ctx
+// carries a status message, until the returned func is called.
+func watchProgress(ctx context.Context, params *mcp.CallToolParams) func() {
+	p, _ := ctx.Value(toolProgressKey{}).(*toolProgress)
+	if p == nil {
+		return func() {}
+	}
+	token := newPromptID()
+	params.SetProgressToken(token)
+	progressTokensMu.Lock()
+	progressTokens[token] = p
+	progressTokensMu.Unlock()
+	return func() {
+		progressTokensMu.Lock()
+		delete(progressTokens, token)
+		progressTokensMu.Unlock()
+	}
+}
+
+// handleProgress is the MCP client's progress notification handler.
+func handleProgress(_ context.Context, req *mcp.ProgressNotificationClientRequest) {
+	token, _ := req.Params.ProgressToken.(string)
+	progressTokensMu.Lock()
+	p := progressTokens[token]
+	progressTokensMu.Unlock()
+	if p != nil {
+		p.update(req.Params)
+	}
+}
+
+// toolOutcome is what a tool call returned.
+type toolOutcome struct {
+	result string
+	err    error
+}
+
+// toolCall is a call made by runToolCall.
+type toolCall struct {
+	toolOutcome
+	attachments *toolAttachments
+	elapsed     time.Duration
+	// background is set when the call outlasted toolTurnWait; it continues
+	// and its result will be posted in the channel.
+	background bool
+}
+
+// runToolCall runs t within its timeout, showing its progress in the channel
+// and collecting the files it returns. It waits at most toolTurnWait for a call
+// that may run longer, then leaves it to finish in the background.
+func runToolCall(s *discordgo.Session, t *registeredTool, userID, channelID, guildID string, args map[string]any) toolCall {
+	timeout := toolTimeout(t)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	progress := newToolProgress(s, channelID, t.Name)
+	call := toolCall{attachments: &toolAttachments{}}
+	ctx = withToolProgress(withToolAttachments(ctx, call.attachments), progress)
+	done := make(chan toolOutcome, 1)
+	go func() {
+		defer cancel()
+		result, err := invokeTool(ctx, t, userID, "", channelID, guildID, args)
+		done <- toolOutcome{result, err}
+	}()
+	var turnWait <-chan time.Time
+	if timeout > toolTurnWait {
+		timer := time.NewTimer(toolTurnWait)
+		defer timer.Stop()
+		turnWait = timer.C
+	}
+	select {
+	case call.toolOutcome = <-done:
+	case <-turnWait:
+		progress.toBackground()
+		go finishInBackground(s, userID, channelID, t.Name, progress, call.attachments, done)
+		call.background = true
+		return call
+	}
+	progress.finish(resultStatus(call.result, call.err) == "success")
+	call.elapsed = time.Since(progress.start)
+	return call
+}
+
+// finishInBackground waits for a call that outlasted its chat turn and posts
+// its result.
+func finishInBackground(s *discordgo.Session, userID, channelID, tool string, progress *toolProgress, attachments *toolAttachments, done <-chan toolOutcome) {
+	out := <-done
+	progress.finish(resultStatus(out.result, out.err) == "success")
+	postToolResult(s, userID, channelID, tool, time.Since(progress.start), out.result, out.err, attachments.take())
+}
+
+// postToolResult posts the result of a call that finished in the background,
+// mentioning the user who made it, and adds it to the channel's history so the
+// model knows about it: offloaded if large, and framed as untrusted tool
+// output rather than as the model's own words.
+func postToolResult(s *discordgo.Session, userID, channelID, tool string, elapsed time.Duration, result string, err error, files []*discordgo.File) {
+	var content string
+	switch {
+	case err != nil:
+		content = fmt.Sprintf("⚠️ <@%s>, `%s` failed after %s: %v", userID, tool, formatDuration(elapsed), err)
+	case resultStatus(result, nil) == "error":
+		content = fmt.Sprintf("⚠️ <@%s>, `%s` reported an error after %s:\n%s", userID, tool, formatDuration(elapsed), result)
+	default:
+		content = fmt.Sprintf("✅ <@%s>, `%s` finished after %s:\n%s", userID, tool, formatDuration(elapsed), result)
+	}
+	if utf8.RuneCountInString(content) > discordMessageLimit {
+		// Too long for a message: show the start and attach the full result.
+		content = truncateToLimit(content, discordMessageLimit-40) + "\n… (full result attached)"
+		files = append(files, textAttachment(tool, result))
+	}
+	if _, err := s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content:         content,
+		Files:           files,
+		AllowedMentions: &discordgo.MessageAllowedMentions{Users: []string{userID}},
+	}); err != nil {
+		log.Errorf("Failed to post the result of %s: %v", tool, err)
+	}
+	recorded := jsonResult("error", fmt.Sprint(err))
+	if err == nil {
+		recorded = offloadToolResult(userID, channelID, tool, result, nil)
+	}
+	getConversation(channelID).appendToolResult(userID, tool, recorded)
+}
+
+// timeoutStatus describes a server's tool timeouts for /mcp status.
+func timeoutStatus(srv *pb.MCPServer) string {
+	status := "Tool timeout: " + formatDuration(defaultToolTimeout) + " (default)"
+	if srv.Timeout > 0 {
+		status = "Tool timeout: " + formatDuration(min(srv.Timeout, maxToolTimeout))
+	}
+	tools := make([]string, 0, len(srv.ToolTimeouts))
+	for tool := range srv.ToolTimeouts {
+		tools = append(tools, tool)
+	}
+	sort.Strings(tools)
+	for i, tool := range tools {
+		tools[i] = fmt.Sprintf("`%s` %s", tool, formatDuration(min(srv.ToolTimeouts[tool], maxToolTimeout)))
+	}
+	if len(tools) > 0 {
+		status += "; " + strings.Join(tools, ", ")
+	}
+	return status
+}
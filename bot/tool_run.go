@@ -0,0 +1,321 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/charmbracelet/log"
+)
+
+// /tools run calls a toolbelt tool directly, without the model: the tool is
+// picked by autocomplete from those the caller may use, its arguments are asked
+// for in a modal built from its input schema (like an elicitation form), and
+// the result is shown to the caller as an embed, or attached when too long.
+// Destructive tools and tools under an approval policy get the usual
+// Confirm/Cancel prompt instead of running.
+
+const (
+	// toolRunFormTimeout is how long an opened form stays valid.
+	toolRunFormTimeout = 15 * time.Minute
+	// embedDescriptionLimit is Discord's limit for an embed's description.
+	embedDescriptionLimit = 4096
+)
+
+// toolRun is a /tools run form waiting to be submitted.
+type toolRun struct {
+	tool    string // owner-qualified name
+	fields  []elicitField
+	userID  string
+	expires time.Time
+}
+
+var (
+	toolRuns   = map[string]*toolRun{}
+	toolRunsMu sync.Mutex
+)
+
+// HandleToolsAutocomplete suggests the tools the caller may run for
+// /tools run.
+func HandleToolsAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	typed := ""
+	for _, sub := range i.ApplicationCommandData().Options {
+		for _, o := range sub.Options {
+			if o.Name == "tool" && o.Focused {
+				typed = strings.ToLower(o.StringValue())
+			}
+		}
+	}
+	c := newToolCaller(s, getUserID(i), i.ChannelID, i.GuildID)
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	tools := accessibleTools(c)
+	names := toolNames(tools)
+	for _, t := range tools {
+		value := names[t]
+		label := value
+		if t.Description != "" {
+			label += " — " + t.Description
+		}
+		if typed != "" && !strings.Contains(strings.ToLower(label), typed) {
+			continue
+		}
+		if len(value) > 100 {
+			continue // Discord's limit for choice values
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: truncateToLimit(label, 100), Value: value})
+	}
+	sort.Slice(choices, func(a, b int) bool { return choices[a].Name < choices[b].Name })
+	if len(choices) > 25 {
+		choices = choices[:25]
+	}
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
+	}); err != nil {
+		log.Warnf("Failed to answer /tools autocomplete: %v", err)
+	}
+}
+
+// handleToolRunCommand handles /tools run tool:<tool>: it opens the tool's
+// form, or runs it at once when it takes no arguments.
+func handleToolRunCommand(s *discordgo.Session, i *discordgo.InteractionCreate, options []*discordgo.ApplicationCommandInteractionDataOption) {
+	name := ""
+	for _, o := range options {
+		if o.Name == "tool" {
+			name = strings.TrimSpace(o.StringValue())
+		}
+	}
+	userID := getUserID(i)
+	t, err := resolveToolToRun(s, i, name)
+	if err != nil {
+		respondWithMessage(s, i, "⚠️ "+err.Error())
+		return
+	}
+
+	fields := elicitFields(schemaMap(t.InputSchema))
+	if len(fields) == 0 {
+		runToolDirectly(s, i, t, map[string]any{})
+		return
+	}
+	required := 0
+	for _, f := range fields {
+		if f.required {
+			required++
+		}
+	}
+	if required > maxElicitationFields {
+		respondWithMessage(s, i, fmt.Sprintf("⚠️ `%s` requires %d arguments, more than a Discord form can hold; ask for it in chat instead.", qualifiedName(t), required))
+		return
+	}
+	// Required fields come first, so only optional ones are left out.
+	run := &toolRun{tool: ownerQualifiedName(t), fields: fields[:min(len(fields), maxElicitationFields)], userID: userID, expires: time.Now().Add(toolRunFormTimeout)}
+	id := newPromptID()
+	toolRunsMu.Lock()
+	for k, r := range toolRuns {
+		if time.Now().After(r.expires) {
+			delete(toolRuns, k)
+		}
+	}
+	toolRuns[id] = run
+	toolRunsMu.Unlock()
+
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID:   "toolrun_" + id,
+			Title:      truncateToLimit("Run "+t.Name, 45),
+			Components: elicitationModalFields(run.fields),
+		},
+	}); err != nil {
+		log.Errorf("Failed to open the form for %s: %v", run.tool, err)
+	}
+}
+
+// resolveToolToRun finds the tool named by /tools run among those the caller
+// may use.
+func resolveToolToRun(s *discordgo.Session, i *discordgo.InteractionCreate, name string) (*registeredTool, error) {
+	if name == "" {
+		return nil, fmt.Errorf("name a tool to run")
+	}
+	c := newToolCaller(s, getUserID(i), i.ChannelID, i.GuildID)
+	t, err := resolveAccessibleTool(c, name)
+	if err != nil {
+		return nil, err
+	}
+	if t != nil {
+		return t, nil
+	}
+	if u, _ := resolveTool(unlinkedTools(c), c, name); u != nil {
+		return nil, fmt.Errorf("`%s` runs tools as you; link your account with `/mcp link name:%s` first", u.LinkServer, u.LinkServer)
+	}
+	return nil, fmt.Errorf("no tool named `%s` is available to you", name)
+}
+
+// handleToolRunModal handles a submitted /tools run form. It reports whether
+// the interaction was one.
+func handleToolRunModal(s *discordgo.Session, i *discordgo.InteractionCreate) bool {
+	data := i.ModalSubmitData()
+	if !strings.HasPrefix(data.CustomID, "toolrun_") {
+		return false
+	}
+	id := strings.TrimPrefix(data.CustomID, "toolrun_")
+	toolRunsMu.Lock()
+	run := toolRuns[id]
+	delete(toolRuns, id)
+	toolRunsMu.Unlock()
+	if run == nil || time.Now().After(run.expires) {
+		respondWithMessage(s, i, "This form has expired; run `/tools run` again.")
+		return true
+	}
+	if getUserID(i) != run.userID {
+		respondWithMessage(s, i, fmt.Sprintf("Only <@%s> can submit this.", run.userID))
+		return true
+	}
+	// Access is checked again: it may have changed while the form was open.
+	t, err := resolveToolToRun(s, i, run.tool)
+	if err != nil {
+		respondWithMessage(s, i, "⚠️ "+err.Error())
+		return true
+	}
+
+	values := modalValues(data)
+	args := map[string]any{}
+	var problems []string
+	for _, f := range run.fields {
+		raw := values[f.name]
+		if raw == "" {
+			continue // required fields are enforced by the modal
+		}
+		v, err := parseToolRunValue(f, raw)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("**%s**: %v", f.title, err))
+			continue
+		}
+		args[f.name] = v
+	}
+	if len(problems) > 0 {
+		respondWithMessage(s, i, "⚠️ "+strings.Join(problems, "\n")+"\nRun `/tools run` to try again.")
+		return true
+	}
+	runToolDirectly(s, i, t, args)
+	return true
+}
+
+// parseToolRunValue converts a typed argument to the field's type. Objects and
+// arrays are typed as JSON.
+func parseToolRunValue(f elicitField, raw string) (any, error) {
+	if len(f.enum) == 0 && (f.kind == "object" || f.kind == "array") {
+		var v any
+		if err := json.Unmarshal([]byte(raw), &v); err != nil {
+			return nil, fmt.Errorf("must be JSON (an %s)", f.kind)
+		}
+		return v, nil
+	}
+	return parseElicitValue(f, raw)
+}
+
+// runToolDirectly validates args and runs t for the user behind i, or asks for
+// confirmation the way call_tool would, and answers i with the outcome.
+func runToolDirectly(s *discordgo.Session, i *discordgo.InteractionCreate, t *registeredTool, args map[string]any) {
+	userID := getUserID(i)
+	name := qualifiedName(t)
+	if errs := validateArgs(t.InputSchema, args); len(errs) > 0 {
+		problems := make([]string, 0, len(errs))
+		for _, e := range errs {
+			problems = append(problems, fmt.Sprintf("**%s**: %s", e.Path, e.Message))
+		}
+		respondWithMessage(s, i, fmt.Sprintf("⚠️ Invalid arguments for `%s`:\n%s\nRun `/tools run` to try again.", name, strings.Join(problems, "\n")))
+		return
+	}
+	rule, err := approvalRuleFor(t)
+	if err != nil {
+		respondWithMessage(s, i, "⚠️ "+err.Error())
+		return
+	}
+	if t.Destructive || rule != nil {
+		header := fmt.Sprintf("⚠️ **Destructive action requested:** `%s`", t.Name)
+		if !t.Destructive {
+			header = fmt.Sprintf("🔐 **Approval required:** `%s` was requested by <@%s>.", t.Name, userID)
+		}
+		if err := requestConfirmation(s, t, args, userID, i.ChannelID, i.GuildID, header, rule); err != nil {
+			log.Errorf("failed to send confirmation prompt for %s: %v", name, err)
+			respondWithMessage(s, i, "⚠️ Failed to send the confirmation prompt.")
+			return
+		}
+		respondWithMessage(s, i, fmt.Sprintf("`%s` needs confirmation before it runs; a Confirm/Cancel prompt was posted.", name))
+		return
+	}
+
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+	}); err != nil {
+		log.Errorf("Failed to acknowledge /tools run: %v", err)
+		return
+	}
+
+	// As in handleCallTool, a long call moves to the background and its
+	// result is posted in the channel; see tool_progress.go.
+	call := runToolCall(s, t, userID, i.ChannelID, i.GuildID, args)
+	if call.background {
+		content := fmt.Sprintf("⏳ `%s` is still running after %s and continues in the background (time limit %s); its result will be posted in this channel.", name, formatDuration(toolTurnWait), formatDuration(toolTimeout(t)))
+		if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content}); err != nil {
+			log.Warnf("Failed to update /tools run reply: %v", err)
+		}
+		return
+	}
+
+	embed, files := toolResultEmbed(name, call.result, call.err, call.elapsed)
+	embeds := []*discordgo.MessageEmbed{embed}
+	if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Embeds: &embeds,
+		Files:  append(call.attachments.take(), files...),
+	}); err != nil {
+		log.Errorf("Failed to post the result of %s: %v", name, err)
+	}
+}
+
+// toolResultEmbed renders a tool's result, attaching it in full when it does
+// not fit in the embed. JSON results are indented.
+func toolResultEmbed(name, result string, err error, elapsed time.Duration) (*discordgo.MessageEmbed, []*discordgo.File) {
+	embed := &discordgo.MessageEmbed{
+		Type:   discordgo.EmbedTypeRich,
+		Title:  "✅ " + name,
+		Color:  0x2ecc71,
+		Footer: &discordgo.MessageEmbedFooter{Text: "Finished after " + formatDuration(elapsed)},
+	}
+	if err != nil {
+		embed.Title = "⚠️ " + name
+		embed.Color = 0xe74c3c
+		embed.Description = truncateToLimit(err.Error(), embedDescriptionLimit)
+		embed.Footer.Text = "Failed after " + formatDuration(elapsed)
+		return embed, nil
+	}
+	if resultStatus(result, nil) == "error" {
+		embed.Title = "⚠️ " + name
+		embed.Color = 0xe74c3c
+		embed.Footer.Text = "Reported an error after " + formatDuration(elapsed)
+	}
+
+	lang := ""
+	var indented bytes.Buffer
+	if json.Indent(&indented, []byte(result), "", "  ") == nil {
+		result, lang = indented.String(), "json"
+	}
+	// A zero-width space keeps the result from closing the code block.
+	shown := strings.ReplaceAll(result, "```", "`\u200b``")
+	block := "```" + lang + "\n" + shown + "\n```"
+	if utf8.RuneCountInString(block) <= embedDescriptionLimit {
+		embed.Description = block
+		return embed, nil
+	}
+	// Too long for the embed: show the start and attach the full result.
+	embed.Description = "```" + lang + "\n" + truncateToLimit(shown, embedDescriptionLimit-60) + "\n```\n… (full result attached)"
+	return embed, []*discordgo.File{textAttachment(strings.ReplaceAll(name, "/", "_"), result)}
+}
@@ -0,0 +1,250 @@
+package bot
+
+import (
+	"context"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/charmbracelet/log"
+)
+
+// find_tools ranks the tool catalog against the query rather than matching
+// substrings, so a request in the user's own words ("take a snapshot of the
+// database") can still find a tool named backup_create. Tools are searched by
+// their qualified name, description and argument names and descriptions. When
+// REGOLO_EMBEDDING_MODEL is set they are ranked by embedding similarity,
+// otherwise (or if the embeddings request fails) by BM25. Only the top results
+// are returned, so the catalog can grow to hundreds of tools.
+
+const (
+	defaultFindToolsLimit = 10
+	maxFindToolsLimit     = 50
+
+	// BM25 parameters, at their usual values.
+	bm25K1 = 1.2
+	bm25B  = 0.75
+
+	// embeddingBatch is how many texts are embedded per request, and
+	// maxEmbeddingCache how many tool embeddings are kept.
+	embeddingBatch    = 64
+	maxEmbeddingCache = 5000
+)
+
+// Ranking methods, as reported by find_tools.
+const (
+	rankingSemantic = "semantic"
+	rankingBM25     = "bm25"
+)
+
+// embeddingModel returns the Regolo model used to embed tools, or "" to rank
+// with BM25 only.
+func embeddingModel() string {
+	return strings.TrimSpace(os.Getenv("REGOLO_EMBEDDING_MODEL"))
+}
+
+// toolDocument is the text a tool is searched by.
+func toolDocument(t *registeredTool) string {
+	var sb strings.Builder
+	sb.WriteString(qualifiedName(t))
+	if t.Description != "" {
+		sb.WriteString("\n" + t.Description)
+	}
+	props, _ := schemaMap(t.InputSchema)["properties"].(map[string]any)
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sb.WriteString("\n" + name)
+		if p, ok := props[name].(map[string]any); ok {
+			if d, _ := p["description"].(string); d != "" {
+				sb.WriteString(": " + d)
+			}
+		}
+	}
+	return sb.String()
+}
+
+// rankTools scores each tool's relevance to query and reports the method used.
+// Tools with no relevance under BM25 score 0.
+func rankTools(ctx context.Context, query string, ts []*registeredTool) ([]float64, string) {
+	docs := make([]string, len(ts))
+	for i, t := range ts {
+		docs[i] = toolDocument(t)
+	}
+	if model := embeddingModel(); model != "" {
+		scores, err := rankEmbeddings(ctx, model, query, docs)
+		if err == nil {
+			return scores, rankingSemantic
+		}
+		log.Warnf("Tool search with embeddings failed, using BM25: %v", err)
+	}
+
+	tokens := make([][]string, len(ts))
+	for i, t := range ts {
+		// The name counts twice: it says most about what a tool does.
+		tokens[i] = append(tokenize(qualifiedName(t)), tokenize(docs[i])...)
+	}
+	return rankBM25(tokenize(query), tokens), rankingBM25
+}
+
+// rankBM25 scores each document (as tokens) against the query tokens.
+func rankBM25(query []string, docs [][]string) []float64 {
+	scores := make([]float64, len(docs))
+	if len(docs) == 0 || len(query) == 0 {
+		return scores
+	}
+	terms := map[string]bool{}
+	for _, q := range query {
+		terms[q] = true
+	}
+	total := 0
+	df := map[string]int{}
+	freqs := make([]map[string]int, len(docs))
+	for i, doc := range docs {
+		total += len(doc)
+		freqs[i] = map[string]int{}
+		for _, tok := range doc {
+			if terms[tok] {
+				freqs[i][tok]++
+			}
+		}
+		for tok := range freqs[i] {
+			df[tok]++
+		}
+	}
+	avg := float64(total) / float64(len(docs))
+	n := float64(len(docs))
+	for i, doc := range docs {
+		norm := bm25K1 * (1 - bm25B + bm25B*float64(len(doc))/max(avg, 1))
+		for tok, tf := range freqs[i] {
+			idf := math.Log(1 + (n-float64(df[tok])+0.5)/(float64(df[tok])+0.5))
+			scores[i] += idf * float64(tf) * (bm25K1 + 1) / (float64(tf) + norm)
+		}
+	}
+	return scores
+}
+
+// searchStopWords are left out of BM25 queries and documents.
+var searchStopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"for": true, "from": true, "i": true, "in": true, "is": true, "it": true, "me": true, "my": true,
+	"of": true, "on": true, "or": true, "please": true, "that": true, "the": true, "this": true,
+	"to": true, "with": true,
+}
+
+// tokenize splits text into lowercase words for BM25, also at underscores,
+// slashes and camelCase boundaries, so "backup_create" and "backupCreate"
+// both yield "backup" and "create". Plurals are reduced to the singular.
+func tokenize(text string) []string {
+	var tokens []string
+	var word []rune
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+		w := singular(strings.ToLower(string(word)))
+		if !searchStopWords[w] {
+			tokens = append(tokens, w)
+		}
+		word = word[:0]
+	}
+	var prev rune
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if unicode.IsUpper(r) && unicode.IsLower(prev) {
+				flush()
+			}
+			word = append(word, r)
+		default:
+			flush()
+		}
+		prev = r
+	}
+	flush()
+	return tokens
+}
+
+func singular(w string) string {
+	switch {
+	case len(w) > 4 && strings.HasSuffix(w, "ies"):
+		return w[:len(w)-3] + "y"
+	case len(w) > 3 && strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss"):
+		return w[:len(w)-1]
+	}
+	return w
+}
+
+var (
+	// embeddingCache holds tool embeddings, keyed by model and document, so
+	// each tool is embedded once until it changes.
+	embeddingCache   = map[string][]float64{}
+	embeddingCacheMu sync.Mutex
+)
+
+// rankEmbeddings scores each document by the cosine similarity of its
+// embedding to the query's.
+func rankEmbeddings(ctx context.Context, model, query string, docs []string) ([]float64, error) {
+	key := func(doc string) string { return model + "\x00" + doc }
+	embedded := make(map[string][]float64, len(docs))
+	var missing []string
+	embeddingCacheMu.Lock()
+	for _, doc := range docs {
+		if e, ok := embeddingCache[key(doc)]; ok {
+			embedded[doc] = e
+		} else if _, seen := embedded[doc]; !seen {
+			embedded[doc] = nil
+			missing = append(missing, doc)
+		}
+	}
+	embeddingCacheMu.Unlock()
+
+	q, err := regoloEmbed(ctx, model, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	for start := 0; start < len(missing); start += embeddingBatch {
+		batch := missing[start:min(start+embeddingBatch, len(missing))]
+		embs, err := regoloEmbed(ctx, model, batch)
+		if err != nil {
+			return nil, err
+		}
+		embeddingCacheMu.Lock()
+		if len(embeddingCache)+len(batch) > maxEmbeddingCache {
+			embeddingCache = map[string][]float64{}
+		}
+		for i, doc := range batch {
+			embedded[doc] = embs[i]
+			embeddingCache[key(doc)] = embs[i]
+		}
+		embeddingCacheMu.Unlock()
+	}
+
+	scores := make([]float64, len(docs))
+	for i, doc := range docs {
+		scores[i] = cosine(q[0], embedded[doc])
+	}
+	return scores, nil
+}
+
+func cosine(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
@@ -0,0 +1,70 @@
+package bot
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// TestTokenize checks the splitting and normalizing BM25 relies on.
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"backup_create", []string{"backup", "create"}},
+		{"backupCreate", []string{"backup", "create"}},
+		{"backups/run_backup", []string{"backup", "run", "backup"}},
+		{"List all the databases", []string{"list", "all", "database"}},
+		{"policies for the class", []string{"policy", "class"}},
+		{"HTTPServer v2", []string{"httpserver", "v2"}},
+		{"a the of", nil},
+	}
+	for _, tc := range tests {
+		if got := tokenize(tc.text); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("tokenize(%q) = %q, want %q", tc.text, got, tc.want)
+		}
+	}
+}
+
+// TestRankToolsBM25 checks that a request in the user's own words finds the
+// tool that does it, and that unrelated tools score nothing.
+func TestRankToolsBM25(t *testing.T) {
+	t.Setenv("REGOLO_EMBEDDING_MODEL", "")
+	ts := []*registeredTool{
+		{Name: "execute_ssh_command", Source: "local", Description: "Run a shell command on the connected server."},
+		{Name: "backup_create", Source: serverKey("alice", "backups"), Owner: "alice", Description: "Take a snapshot of a database and store it.",
+			InputSchema: map[string]any{"type": "object", "properties": map[string]any{"database": map[string]any{"type": "string", "description": "The database to back up."}}}},
+		{Name: "backup_restore", Source: serverKey("alice", "backups"), Owner: "alice", Description: "Restore a database from a backup."},
+		{Name: "list_reminders", Source: "local", Description: "List your reminders."},
+	}
+
+	tests := []struct {
+		query string
+		best  string
+	}{
+		{"take a snapshot of the database", "backup_create"},
+		{"restore backups", "backup_restore"},
+		{"run a shell command", "execute_ssh_command"},
+	}
+	for _, tc := range tests {
+		scores, ranking := rankTools(context.Background(), tc.query, ts)
+		if ranking != rankingBM25 {
+			t.Fatalf("ranking = %q, want %q", ranking, rankingBM25)
+		}
+		best := 0
+		for i := range scores {
+			if scores[i] > scores[best] {
+				best = i
+			}
+		}
+		if ts[best].Name != tc.best {
+			t.Errorf("%q ranked %s first (scores %v), want %s", tc.query, ts[best].Name, scores, tc.best)
+		}
+	}
+
+	scores, _ := rankTools(context.Background(), "take a snapshot of the database", ts)
+	if scores[3] != 0 {
+		t.Errorf("list_reminders scored %v for an unrelated query, want 0", scores[3])
+	}
+}
@@ -5,9 +5,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
+	"sort"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
@@ -21,11 +22,13 @@ import (
 type registeredTool struct {
 	Name        string
 	Description string
-	InputSchema any    // JSON Schema for the tool's arguments
-	Source      string // "local" for built-in tools, else serverKey(owner, name)
-	Owner       string // "" for local/legacy tools, else the owning Discord user ID
-	Visibility  string // pb.MCPVisibility{Private,Admins,Public}
-	Destructive bool   // requires an admin Confirm/Cancel button before running
+	InputSchema any           // JSON Schema for the tool's arguments
+	Source      string        // "local" for built-in tools, else serverKey(owner, name)
+	Owner       string        // "" for local/legacy tools, else the owning Discord user ID
+	Visibility  string        // pb.MCPVisibility{Private,Admins,Public}
+	Destructive bool          // requires an admin Confirm/Cancel button before running
+	LinkServer  string        // OAuth server name; each caller must /mcp link it to run the tool
+	Timeout     time.Duration // how long a call may run; 0 for defaultToolTimeout
 	Invoke      func(ctx context.Context, userID, channelID, guildID string, args map[string]any) (string, error)
 }
 
@@ -60,50 +63,170 @@ func unregisterSource(source string) int {
 	return n
 }
 
-// canAccess reports whether the caller may see/use a tool.
-func canAccess(t *registeredTool, callerID string, isAdmin bool) bool {
-	if t.Owner != "" && t.Owner == callerID {
+// unregisterTool removes one tool, reporting whether it was registered.
+func unregisterTool(source, name string) bool {
+	toolRegistryMu.Lock()
+	defer toolRegistryMu.Unlock()
+	key := regKey(source, name)
+	_, ok := toolRegistry[key]
+	delete(toolRegistry, key)
+	return ok
+}
+
+// lookupTool returns the registered tool with the given source and name, or
+// nil if it is no longer registered (e.g. its server disconnected).
+func lookupTool(source, name string) *registeredTool {
+	toolRegistryMu.RLock()
+	defer toolRegistryMu.RUnlock()
+	return toolRegistry[regKey(source, name)]
+}
+
+// canAccess reports whether the caller may see/use a tool: owner and
+// visibility first, refined by tool policies (see policy.go). Access is denied
+// when the policies cannot be loaded.
+func canAccess(t *registeredTool, c toolCaller) bool {
+	policies, err := toolPolicies()
+	if err != nil {
+		return false
+	}
+	return canAccessUnder(policies, t, c)
+}
+
+// canAccessUnder is canAccess with the policies already loaded.
+func canAccessUnder(policies []*pb.ToolPolicy, t *registeredTool, c toolCaller) bool {
+	allowed, denied := policyDecision(policies, t, c)
+	if denied {
+		return false
+	}
+	if t.Owner != "" && t.Owner == c.userID {
 		return true // you always have access to your own servers
 	}
 	switch t.Visibility {
 	case pb.MCPVisibilityPublic:
 		return true
 	case pb.MCPVisibilityAdmins:
-		return isAdmin
+		return c.isAdmin || allowed
 	default: // private
 		return false
 	}
 }
 
-// accessibleTools returns the tools the caller may use.
-func accessibleTools(callerID string, isAdmin bool) []*registeredTool {
+// accessibleTools returns the tools the caller may use, or none when the
+// policies cannot be loaded.
+func accessibleTools(c toolCaller) []*registeredTool {
+	// Policies are loaded before taking the registry lock, so a slow database
+	// doesn't hold up tool registration.
+	policies, err := toolPolicies()
+	if err != nil {
+		return nil
+	}
 	toolRegistryMu.RLock()
 	defer toolRegistryMu.RUnlock()
 	out := make([]*registeredTool, 0, len(toolRegistry))
 	for _, t := range toolRegistry {
-		if canAccess(t, callerID, isAdmin) {
+		if canAccessUnder(policies, t, c) && (t.LinkServer == "" || isOAuthLinked(t.Source, c.userID)) {
 			out = append(out, t)
 		}
 	}
 	return out
 }
 
-// resolveAccessibleTool finds a tool by name among those the caller may use,
-// preferring one the caller owns when names collide.
-func resolveAccessibleTool(callerID string, isAdmin bool, name string) *registeredTool {
-	var match *registeredTool
-	for _, t := range accessibleTools(callerID, isAdmin) {
-		if t.Name != name {
-			continue
+// unlinkedTools returns the tools the caller may use once they link the OAuth
+// server they come from.
+func unlinkedTools(c toolCaller) []*registeredTool {
+	policies, err := toolPolicies()
+	if err != nil {
+		return nil
+	}
+	toolRegistryMu.RLock()
+	defer toolRegistryMu.RUnlock()
+	var out []*registeredTool
+	for _, t := range toolRegistry {
+		if t.LinkServer != "" && canAccessUnder(policies, t, c) && !isOAuthLinked(t.Source, c.userID) {
+			out = append(out, t)
 		}
-		if t.Owner == callerID {
-			return t
+	}
+	return out
+}
+
+// qualifiedName identifies a tool by its server and name, e.g.
+// "backups/run_backup" or "local/execute_ssh_command", so that tools of
+// different servers with the same name can be told apart.
+func qualifiedName(t *registeredTool) string { return toolServer(t) + "/" + t.Name }
+
+// ownerQualifiedName also names the server's owner, e.g.
+// "backups@123456789/run_backup": server names are only unique per owner, so
+// this is the name of a tool whose qualified name is shared. Tools without an
+// owner have only their qualified name.
+func ownerQualifiedName(t *registeredTool) string {
+	if t.Owner == "" {
+		return qualifiedName(t)
+	}
+	return toolServer(t) + "@" + t.Owner + "/" + t.Name
+}
+
+// toolNames returns the name to show for each of ts: its qualified name, or
+// its owner-qualified name when another of ts has the same qualified name.
+func toolNames(ts []*registeredTool) map[*registeredTool]string {
+	count := map[string]int{}
+	for _, t := range ts {
+		count[qualifiedName(t)]++
+	}
+	names := make(map[*registeredTool]string, len(ts))
+	for _, t := range ts {
+		names[t] = qualifiedName(t)
+		if count[names[t]] > 1 {
+			names[t] = ownerQualifiedName(t)
 		}
-		if match == nil {
-			match = t
+	}
+	return names
+}
+
+// resolveTool finds the tool name refers to among ts: by owner-qualified or
+// qualified name, or by bare tool name when only one server offers it. A
+// qualified name shared by two owners' servers of the same name resolves to
+// the caller's own. Any other ambiguity is an error listing the candidates by
+// names that resolve.
+func resolveTool(ts []*registeredTool, c toolCaller, name string) (*registeredTool, error) {
+	var matches []*registeredTool
+	for _, t := range ts {
+		if t.Name == name || qualifiedName(t) == name || ownerQualifiedName(t) == name {
+			matches = append(matches, t)
+		}
+	}
+	if len(matches) <= 1 {
+		if len(matches) == 0 {
+			return nil, nil
+		}
+		return matches[0], nil
+	}
+	if strings.Contains(name, "/") {
+		for _, t := range matches {
+			if t.Owner == c.userID && qualifiedName(t) == name {
+				return t, nil
+			}
 		}
 	}
-	return match
+	names := toolNames(matches)
+	candidates := make([]string, 0, len(matches))
+	for _, t := range matches {
+		candidate := fmt.Sprintf("%q", names[t])
+		if t.Owner != "" && t.Owner != c.userID {
+			candidate += fmt.Sprintf(" (a server of user id:%s)", t.Owner)
+		}
+		candidates = append(candidates, candidate)
+	}
+	sort.Strings(candidates)
+	if strings.Contains(name, "/") {
+		return nil, fmt.Errorf("%q is ambiguous: servers of different users share the name (%s); call one of them by its owner-qualified name", name, strings.Join(candidates, ", "))
+	}
+	return nil, fmt.Errorf("%q is ambiguous: it matches %s; call one of them by that name", name, strings.Join(candidates, ", "))
+}
+
+// resolveAccessibleTool finds a tool by name among those the caller may use;
+// see resolveTool.
+func resolveAccessibleTool(c toolCaller, name string) (*registeredTool, error) {
+	return resolveTool(accessibleTools(c), c, name)
 }
 
 // ToolbeltTools are the only extended-tool entries the model sees directly;
@@ -113,13 +236,17 @@ var ToolbeltTools = []Tool{
 		Type: "function",
 		Function: functionSpec{
 			Name:        "find_tools",
-			Description: "Discover extended tools available to you through the toolbelt (SSH management, backups, and other integrations). Returns each matching tool's name, description, and JSON input schema. Call this before call_tool to learn the exact tool name and its arguments.",
+			Description: "Discover extended tools available to you through the toolbelt (SSH management, backups, and other integrations). Returns the tools most relevant to the query, best first, each with its qualified name (server/tool), relevance score, description, and JSON input schema. Call this before call_tool to learn the exact tool name and its arguments.",
 			Parameters: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
 					"query": map[string]interface{}{
 						"type":        "string",
-						"description": "Optional case-insensitive filter matched against tool names and descriptions. Omit or leave empty to list every tool available to you.",
+						"description": "What you want to do, in plain words (e.g. \"take a snapshot of the database\"). Omit or leave empty to list tools by name.",
+					},
+					"limit": map[string]interface{}{
+						"type":        "integer",
+						"description": "How many tools to return (default 10, at most 50).",
 					},
 				},
 			},
@@ -129,13 +256,13 @@ var ToolbeltTools = []Tool{
 		Type: "function",
 		Function: functionSpec{
 			Name:        "call_tool",
-			Description: "Invoke a toolbelt tool discovered via find_tools. Provide the exact tool name and an arguments object matching that tool's input schema. Destructive tools require the user to confirm with a button before they run.",
+			Description: "Invoke a toolbelt tool discovered via find_tools. Provide the tool's qualified name (server/tool) and an arguments object matching that tool's input schema. Destructive tools require the user to confirm with a button before they run. Tools marked requires_admin_approval send an access request to the admins instead of running right away. Tools marked requires_link can't run until the user links their account with the given /mcp link command.",
 			Parameters: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
 					"name": map[string]interface{}{
 						"type":        "string",
-						"description": "The exact tool name, as returned by find_tools.",
+						"description": "The qualified tool name (server/tool, or server@owner/tool when servers of different users share a name), as returned by find_tools. A bare tool name works only when a single server offers it.",
 					},
 					"arguments": map[string]interface{}{
 						"type":        "object",
@@ -148,165 +275,190 @@ var ToolbeltTools = []Tool{
 	},
 }
 
-// handleFindTools returns a JSON catalog of the tools the caller may use,
-// optionally filtered by a query, including each tool's input schema.
-func handleFindTools(callerID string, isAdmin bool, args map[string]any) string {
-	query := strings.ToLower(strings.TrimSpace(getStr(args, "query")))
+// handleFindTools returns a JSON catalog of the tools the caller may use, plus
+// the admin-only tools they may request and the tools of OAuth servers they
+// have yet to link, with each tool's input schema. With a query, the most
+// relevant tools are returned with their scores (see tool_search.go);
+// without one, tools are listed by name. Either way at most limit are
+// returned.
+func handleFindTools(c toolCaller, args map[string]any) string {
+	query := strings.TrimSpace(getStr(args, "query"))
+	limit := defaultFindToolsLimit
+	if n, ok := args["limit"].(float64); ok && n >= 1 {
+		limit = min(int(n), maxFindToolsLimit)
+	}
 
 	type toolInfo struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
-		InputSchema any    `json:"input_schema"`
-		Destructive bool   `json:"destructive"`
-	}
-	infos := []toolInfo{}
-	for _, t := range accessibleTools(callerID, isAdmin) {
-		if query != "" && !strings.Contains(strings.ToLower(t.Name+" "+t.Description), query) {
-			continue
+		Name        string  `json:"name"` // qualified: server/tool or server@owner/tool
+		Score       float64 `json:"score,omitempty"`
+		Description string  `json:"description"`
+		InputSchema any     `json:"input_schema"`
+		Destructive bool    `json:"destructive"`
+		// RequiresApproval is set for admin-only tools: calling one sends an
+		// access request to the admins instead of running it.
+		RequiresApproval bool `json:"requires_admin_approval,omitempty"`
+		// RequiresLink is set for tools of an OAuth server the caller hasn't
+		// linked: the command that links it.
+		RequiresLink string `json:"requires_link,omitempty"`
+	}
+	var tools []*registeredTool
+	var infos []toolInfo
+	add := func(ts []*registeredTool, approval, link bool) {
+		for _, t := range ts {
+			info := toolInfo{Name: qualifiedName(t), Description: t.Description, InputSchema: t.InputSchema, Destructive: t.Destructive, RequiresApproval: approval}
+			if link {
+				info.RequiresLink = "/mcp link name:" + t.LinkServer
+			}
+			tools = append(tools, t)
+			infos = append(infos, info)
 		}
-		infos = append(infos, toolInfo{t.Name, t.Description, t.InputSchema, t.Destructive})
 	}
-	b, err := json.Marshal(map[string]any{"tools": infos, "count": len(infos)})
+	add(accessibleTools(c), false, false)
+	add(requestableTools(c), true, false)
+	add(unlinkedTools(c), false, true)
+	names := toolNames(tools)
+	for i, t := range tools {
+		infos[i].Name = names[t]
+	}
+
+	out := map[string]any{}
+	if query == "" {
+		sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		scores, ranking := rankTools(ctx, query, tools)
+		ranked := make([]toolInfo, 0, len(infos))
+		for i, info := range infos {
+			if ranking == rankingBM25 && scores[i] <= 0 {
+				continue // no word in common with the query
+			}
+			info.Score = math.Round(scores[i]*1000) / 1000
+			ranked = append(ranked, info)
+		}
+		sort.SliceStable(ranked, func(i, j int) bool {
+			if ranked[i].Score != ranked[j].Score {
+				return ranked[i].Score > ranked[j].Score
+			}
+			return ranked[i].Name < ranked[j].Name
+		})
+		infos = ranked
+		out["ranking"] = ranking
+	}
+	out["total"] = len(infos)
+	if len(infos) > limit {
+		infos = infos[:limit]
+		out["note"] = fmt.Sprintf("Showing the first %d of %d tools. Use a more specific query, or a higher limit (at most %d), to see others.", limit, out["total"], maxFindToolsLimit)
+	}
+	if infos == nil {
+		infos = []toolInfo{}
+	}
+	out["tools"] = infos
+	out["count"] = len(infos)
+	b, err := json.Marshal(out)
 	if err != nil {
 		return jsonResult("error", "failed to serialize tool list")
 	}
 	return string(b)
 }
 
+// privileged reports whether a tool can do more than an everyday public tool:
+// it is destructive, or it is not available to everyone (admin-only or private).
+func privileged(t *registeredTool) bool {
+	return t.Destructive || t.Visibility != pb.MCPVisibilityPublic
+}
+
 // handleCallTool dispatches a call to a tool the caller may use. Destructive
 // tools are not run here: a Confirm/Cancel prompt is sent and execution happens
-// on admin confirmation (see handleToolbeltButton).
-func handleCallTool(s *discordgo.Session, userID, channelID, guildID string, args map[string]any) string {
+// on admin confirmation (see pending.go). The same applies to any
+// privileged tool when the turn is untrusted (its context includes other
+// users' messages), so a passive message cannot steer the model into running
+// an admin tool on behalf of the admin who triggered the turn. A non-admin's
+// call of an admin-only tool becomes an access request (see access_request.go).
+func handleCallTool(s *discordgo.Session, userID, channelID, guildID string, args map[string]any, turn *chatTurn) string {
 	name := getStr(args, "name")
 	if name == "" {
 		return jsonResult("error", "call_tool requires a 'name'")
 	}
-	toolArgs, _ := args["arguments"].(map[string]any)
-	if toolArgs == nil {
+	var toolArgs map[string]any
+	switch a := args["arguments"].(type) {
+	case nil:
 		toolArgs = map[string]any{}
+	case map[string]any:
+		toolArgs = a
+	default:
+		return jsonResult("error", "call_tool 'arguments' must be a JSON object")
 	}
 
-	isAdmin := authorizeSSH(s, guildID, userID)
-	t := resolveAccessibleTool(userID, isAdmin, name)
+	caller := newToolCaller(s, userID, channelID, guildID)
+	t, err := resolveAccessibleTool(caller, name)
+	if err != nil {
+		return jsonResult("error", err.Error())
+	}
 	if t == nil {
+		if u, _ := resolveTool(unlinkedTools(caller), caller, name); u != nil {
+			return jsonResult("error", linkPrompt(u.LinkServer))
+		}
+		// An admin-only tool can still be requested; see access_request.go.
+		t, err = resolveTool(requestableTools(caller), caller, name)
+		if err != nil {
+			return jsonResult("error", err.Error())
+		}
+		if t != nil {
+			if errs := validateArgs(t.InputSchema, toolArgs); len(errs) > 0 {
+				return validationResult(t.Name, errs)
+			}
+			return handleAccessRequest(s, t, toolArgs, userID, channelID, guildID)
+		}
 		return jsonResult("error", fmt.Sprintf("no tool named %q is available to you; use find_tools to list what you can use", name))
 	}
 
-	if t.Destructive {
-		id := newPendingID()
-		storePending(id, &pendingAction{tool: t, args: toolArgs, userID: userID, channelID: channelID, guildID: guildID})
-		if err := sendConfirmPrompt(s, channelID, t, toolArgs, id); err != nil {
-			deletePending(id)
-			log.Errorf("failed to send confirmation prompt for %s: %v", name, err)
-			return jsonResult("error", "failed to send the confirmation prompt")
-		}
-		return jsonResult("pending", fmt.Sprintf("%q is a destructive action. A Confirm/Cancel prompt was sent and an admin must approve it. The tool has NOT run yet — do not retry; wait for the user to confirm.", name))
+	// Validate before confirmation or invocation so nothing with side effects
+	// ever sees malformed arguments.
+	if errs := validateArgs(t.InputSchema, toolArgs); len(errs) > 0 {
+		return validationResult(t.Name, errs)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-	defer cancel()
-	result, err := t.Invoke(ctx, userID, channelID, guildID, toolArgs)
+	guarded := turn != nil && turn.untrusted && privileged(t)
+	rule, err := approvalRuleFor(t)
 	if err != nil {
 		return jsonResult("error", err.Error())
 	}
-	return result
-}
-
-// --- Confirmation flow for destructive tools ---
-
-type pendingAction struct {
-	tool      *registeredTool
-	args      map[string]any
-	userID    string
-	channelID string
-	guildID   string
-}
-
-var (
-	pendingActions   = map[string]*pendingAction{}
-	pendingActionsMu sync.Mutex
-	pendingCounter   uint64
-)
-
-func newPendingID() string { return fmt.Sprintf("%d", atomic.AddUint64(&pendingCounter, 1)) }
-
-func storePending(id string, a *pendingAction) {
-	pendingActionsMu.Lock()
-	defer pendingActionsMu.Unlock()
-	pendingActions[id] = a
-}
-
-func takePending(id string) *pendingAction {
-	pendingActionsMu.Lock()
-	defer pendingActionsMu.Unlock()
-	a := pendingActions[id]
-	delete(pendingActions, id)
-	return a
-}
-
-func deletePending(id string) {
-	pendingActionsMu.Lock()
-	defer pendingActionsMu.Unlock()
-	delete(pendingActions, id)
-}
-
-func sendConfirmPrompt(s *discordgo.Session, channelID string, t *registeredTool, args map[string]any, id string) error {
-	argsJSON, _ := json.Marshal(args)
-	content := fmt.Sprintf("⚠️ **Destructive action requested:** `%s`\n```json\n%s\n```\nAn admin must confirm.", t.Name, string(argsJSON))
-	content = truncateToLimit(content, discordMessageLimit)
-	_, err := s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
-		Content: content,
-		Components: []discordgo.MessageComponent{
-			&discordgo.ActionsRow{Components: []discordgo.MessageComponent{
-				&discordgo.Button{Label: "Confirm", Style: discordgo.DangerButton, CustomID: "tb_confirm_" + id},
-				&discordgo.Button{Label: "Cancel", Style: discordgo.SecondaryButton, CustomID: "tb_cancel_" + id},
-			}},
-		},
-	})
-	return err
-}
-
-// handleToolbeltButton handles the Confirm/Cancel buttons for a pending
-// destructive tool. Returns true if it handled the interaction. Only admins may
-// confirm or cancel.
-func handleToolbeltButton(s *discordgo.Session, i *discordgo.InteractionCreate) bool {
-	customID := i.MessageComponentData().CustomID
-	var id string
-	var confirm bool
-	switch {
-	case strings.HasPrefix(customID, "tb_confirm_"):
-		id, confirm = strings.TrimPrefix(customID, "tb_confirm_"), true
-	case strings.HasPrefix(customID, "tb_cancel_"):
-		id = strings.TrimPrefix(customID, "tb_cancel_")
-	default:
-		return false
-	}
-
-	if !authorizeSSH(s, i.GuildID, getUserID(i)) {
-		respondWithMessage(s, i, "Only an admin can confirm or cancel this action.")
-		return true
+	if t.Destructive || guarded || rule != nil {
+		header := fmt.Sprintf("⚠️ **Destructive action requested:** `%s`", t.Name)
+		why := "is a destructive action"
+		switch {
+		case rule != nil && !t.Destructive && !guarded:
+			header = fmt.Sprintf("🔐 **Approval required:** `%s` was requested by <@%s>.", t.Name, userID)
+			why = "falls under an approval policy"
+		case !t.Destructive:
+			header = fmt.Sprintf("🛡️ **Confirmation required:** `%s` was requested by <@%s> in a conversation that includes messages from other users.", t.Name, userID)
+			why = "was requested in a conversation that includes other users' messages, so it needs confirmation"
+		}
+		if err := requestConfirmation(s, t, toolArgs, userID, channelID, guildID, header, rule); err != nil {
+			log.Errorf("failed to send confirmation prompt for %s: %v", name, err)
+			return jsonResult("error", "failed to send the confirmation prompt")
+		}
+		return jsonResult("pending", fmt.Sprintf("%q %s. A Confirm/Cancel prompt was sent and an admin must approve it. The tool has NOT run yet — do not retry; wait for the user to confirm.", name, why))
 	}
 
-	a := takePending(id)
-	if a == nil {
-		respondWithMessage(s, i, "This confirmation has expired or was already handled.")
-		return true
+	// The call collects its own files and reports progress in the channel, so
+	// it can outlast the turn; see tool_progress.go.
+	call := runToolCall(s, t, userID, channelID, guildID, toolArgs)
+	if call.background {
+		return jsonResult("running", fmt.Sprintf("%q is still running after %s and continues in the background (time limit %s). Its result will be posted in this channel when it finishes. Tell the user so, and do not call it again.", t.Name, formatDuration(toolTurnWait), formatDuration(toolTimeout(t))))
 	}
-
-	if !confirm {
-		respondWithMessage(s, i, fmt.Sprintf("❌ Cancelled `%s`.", a.tool.Name))
-		return true
+	if turn != nil {
+		turn.attachments.absorb(call.attachments)
 	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-	defer cancel()
-	result, err := a.tool.Invoke(ctx, a.userID, a.channelID, a.guildID, a.args)
+	result, err := call.result, call.err
 	if err != nil {
-		respondWithMessage(s, i, fmt.Sprintf("⚠️ `%s` failed: %v", a.tool.Name, err))
-		return true
+		return jsonResult("error", err.Error())
+	}
+	if t.Name == "read_tool_output" && t.Source == "local" {
+		return result // already paged
 	}
-	respondWithMessage(s, i, truncateToLimit(fmt.Sprintf("✅ Executed `%s`:\n%s", a.tool.Name, result), discordMessageLimit))
-	return true
+	return offloadToolResult(userID, channelID, t.Name, result, turn)
 }
 
 // --- Local (SSH) tool registration ---
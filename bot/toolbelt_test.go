@@ -0,0 +1,54 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestResolveTool checks name resolution across servers: qualified, bare and
+// owner-qualified names, the caller's own server winning a shared name, and
+// ambiguity errors that list names which resolve.
+func TestResolveTool(t *testing.T) {
+	ssh := &registeredTool{Name: "execute_ssh_command", Source: "local"}
+	aliceBackup := &registeredTool{Name: "run_backup", Source: serverKey("alice", "backup"), Owner: "alice"}
+	bobBackup := &registeredTool{Name: "run_backup", Source: serverKey("bob", "backup"), Owner: "bob"}
+	bobStatus := &registeredTool{Name: "status", Source: serverKey("bob", "backup"), Owner: "bob"}
+	monStatus := &registeredTool{Name: "status", Source: serverKey("bob", "monitor"), Owner: "bob"}
+	ts := []*registeredTool{ssh, aliceBackup, bobBackup, bobStatus, monStatus}
+	carol := toolCaller{userID: "carol"}
+
+	tests := []struct {
+		name   string
+		caller toolCaller
+		want   *registeredTool
+		errHas []string // the name is ambiguous; the error names these
+	}{
+		{name: "local/execute_ssh_command", caller: carol, want: ssh},
+		{name: "execute_ssh_command", caller: carol, want: ssh},
+		{name: "monitor/status", caller: carol, want: monStatus},
+		{name: "backup@bob/run_backup", caller: carol, want: bobBackup},
+		{name: "backup/run_backup", caller: toolCaller{userID: "alice"}, want: aliceBackup},
+		{name: "backup/run_backup", caller: carol, errHas: []string{`"backup@alice/run_backup"`, `"backup@bob/run_backup"`}},
+		{name: "run_backup", caller: carol, errHas: []string{`"backup@alice/run_backup"`, `"backup@bob/run_backup"`}},
+		{name: "status", caller: carol, errHas: []string{`"backup/status"`, `"monitor/status"`}},
+		{name: "missing", caller: carol},
+	}
+	for _, tc := range tests {
+		got, err := resolveTool(ts, tc.caller, tc.name)
+		if tc.errHas != nil {
+			if err == nil {
+				t.Errorf("%s as %s: expected an ambiguity error, got %v", tc.name, tc.caller.userID, got)
+				continue
+			}
+			for _, s := range tc.errHas {
+				if !strings.Contains(err.Error(), s) {
+					t.Errorf("%s as %s: error %q does not mention %s", tc.name, tc.caller.userID, err, s)
+				}
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("%s as %s: got %v, %v; want %v", tc.name, tc.caller.userID, got, err, tc.want)
+		}
+	}
+}
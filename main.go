@@ -81,8 +81,9 @@ func main() {
 
 		pb.Init()
 		app := pb.GetApp()
-		// Register the OAuth callback route before the server starts.
+		// Register the OAuth callback and MCP server routes before the server starts.
 		bot.RegisterOAuthRoutes(app)
+		bot.RegisterMCPServerRoutes(app)
 		log.Info("PocketBase admin UI will be available at http://0.0.0.0:8090/_/")
 		if err := app.Start(); err != nil {
 			log.Fatal("Failed to start PocketBase server:", err)
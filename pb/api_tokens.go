@@ -0,0 +1,136 @@
+package pb
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const apiTokensCollection = "api_tokens"
+
+// apiTokenPrefix marks bitbot API tokens, so a leaked one is recognizable.
+const apiTokenPrefix = "bb_"
+
+// APIToken is a per-user token for bitbot's own MCP endpoint. Only a SHA-256
+// hash of the token is stored; the plaintext is shown once, at creation.
+type APIToken struct {
+	ID         string
+	UserID     string
+	Name       string
+	Hint       string // the token's last characters, to tell tokens apart
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIToken issues a new token for userID and returns its plaintext.
+func CreateAPIToken(userID, name string) (string, *APIToken, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, err
+	}
+	token := apiTokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+
+	app := GetApp()
+	collection, err := app.FindCollectionByNameOrId(apiTokensCollection)
+	if err != nil {
+		return "", nil, err
+	}
+	t := &APIToken{UserID: userID, Name: name, Hint: token[len(token)-4:], CreatedAt: time.Now()}
+	record := core.NewRecord(collection)
+	record.Set("user_id", t.UserID)
+	record.Set("name", t.Name)
+	record.Set("token_hash", hashAPIToken(token))
+	record.Set("hint", t.Hint)
+	record.Set("created_at", formatTime(t.CreatedAt))
+	if err := app.Save(record); err != nil {
+		return "", nil, err
+	}
+	t.ID = record.Id
+	return token, t, nil
+}
+
+// apiTokenTouchInterval is how stale a token's last use may get before it is
+// written again.
+const apiTokenTouchInterval = time.Minute
+
+// LookupAPIToken returns the token matching plaintext, or nil if there is none.
+func LookupAPIToken(token string) (*APIToken, error) {
+	record, err := GetApp().FindFirstRecordByFilter(apiTokensCollection, "token_hash = {:hash}", dbx.Params{"hash": hashAPIToken(token)})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return recordToAPIToken(record), nil
+}
+
+// TouchAPIToken records that t was just used. The write is skipped while the
+// recorded use is under apiTokenTouchInterval old, so a busy client doesn't
+// cause one on every request.
+func TouchAPIToken(t *APIToken) error {
+	if time.Since(t.LastUsedAt) < apiTokenTouchInterval {
+		return nil
+	}
+	app := GetApp()
+	record, err := app.FindRecordById(apiTokensCollection, t.ID)
+	if err != nil {
+		return err
+	}
+	record.Set("last_used_at", formatTime(time.Now()))
+	return app.Save(record)
+}
+
+// ListAPITokens returns userID's tokens, newest first.
+func ListAPITokens(userID string) ([]*APIToken, error) {
+	records, err := GetApp().FindRecordsByFilter(apiTokensCollection, "user_id = {:user}", "-created_at", 0, 0, dbx.Params{"user": userID})
+	if err != nil {
+		if isNotFound(err) {
+			return []*APIToken{}, nil
+		}
+		return nil, err
+	}
+	out := make([]*APIToken, 0, len(records))
+	for _, r := range records {
+		out = append(out, recordToAPIToken(r))
+	}
+	return out, nil
+}
+
+// DeleteAPIToken revokes one of userID's tokens. It returns false if userID has
+// no token with that ID.
+func DeleteAPIToken(id, userID string) (bool, error) {
+	app := GetApp()
+	record, err := app.FindRecordById(apiTokensCollection, id)
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if record.GetString("user_id") != userID {
+		return false, nil
+	}
+	return true, app.Delete(record)
+}
+
+func recordToAPIToken(r *core.Record) *APIToken {
+	return &APIToken{
+		ID:         r.Id,
+		UserID:     r.GetString("user_id"),
+		Name:       r.GetString("name"),
+		Hint:       r.GetString("hint"),
+		CreatedAt:  parseTime(r.GetString("created_at")),
+		LastUsedAt: parseTime(r.GetString("last_used_at")),
+	}
+}
@@ -0,0 +1,151 @@
+package pb
+
+import (
+	"errors"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	approvalPoliciesCollection = "approval_policies"
+	approvalVotesCollection    = "approval_votes"
+)
+
+// Approval votes.
+const (
+	VoteApprove = "approve"
+	VoteDeny    = "deny"
+)
+
+// ErrAlreadyVoted is returned when a voter votes twice on one action.
+var ErrAlreadyVoted = errors.New("already voted on this action")
+
+// ApprovalPolicy requires calls of matching tools to be approved by
+// ApproversRequired distinct approvers before they run. Tool is an exact name
+// or glob and Server an MCP server name ("local" for built-in tools), matched
+// like tool policies. ApproverRoles is a comma-separated list of role IDs; when
+// set, only members of those roles may approve (otherwise any admin may).
+type ApprovalPolicy struct {
+	ID                string
+	Tool              string
+	Server            string
+	ApproversRequired int
+	ExcludeRequester  bool
+	ApproverRoles     string
+	CreatedBy         string
+}
+
+// ApprovalVote is one recorded vote on a pending action.
+type ApprovalVote struct {
+	PendingID string
+	VoterID   string
+	Vote      string
+	CreatedAt time.Time
+}
+
+// ListApprovalPolicies returns every approval policy.
+func ListApprovalPolicies() ([]*ApprovalPolicy, error) {
+	records, err := GetApp().FindAllRecords(approvalPoliciesCollection)
+	if err != nil {
+		if isNotFound(err) {
+			return []*ApprovalPolicy{}, nil
+		}
+		return nil, err
+	}
+	out := make([]*ApprovalPolicy, 0, len(records))
+	for _, r := range records {
+		out = append(out, &ApprovalPolicy{
+			ID:                r.Id,
+			Tool:              r.GetString("tool"),
+			Server:            r.GetString("server"),
+			ApproversRequired: r.GetInt("approvers_required"),
+			ExcludeRequester:  r.GetBool("exclude_requester"),
+			ApproverRoles:     r.GetString("approver_roles"),
+			CreatedBy:         r.GetString("created_by"),
+		})
+	}
+	return out, nil
+}
+
+// CreateApprovalPolicy saves a new approval policy and sets its ID.
+func CreateApprovalPolicy(p *ApprovalPolicy) error {
+	app := GetApp()
+	collection, err := app.FindCollectionByNameOrId(approvalPoliciesCollection)
+	if err != nil {
+		return err
+	}
+	record := core.NewRecord(collection)
+	record.Set("tool", p.Tool)
+	record.Set("server", p.Server)
+	record.Set("approvers_required", p.ApproversRequired)
+	record.Set("exclude_requester", p.ExcludeRequester)
+	record.Set("approver_roles", p.ApproverRoles)
+	record.Set("created_by", p.CreatedBy)
+	if err := app.Save(record); err != nil {
+		return err
+	}
+	p.ID = record.Id
+	return nil
+}
+
+// DeleteApprovalPolicy deletes an approval policy by ID.
+func DeleteApprovalPolicy(id string) error {
+	app := GetApp()
+	record, err := app.FindRecordById(approvalPoliciesCollection, id)
+	if err != nil {
+		return err
+	}
+	return app.Delete(record)
+}
+
+// RecordApprovalVote records a vote, returning ErrAlreadyVoted if voterID has
+// already voted on pendingID.
+func RecordApprovalVote(pendingID, voterID, vote string) error {
+	app := GetApp()
+	existing, err := app.FindFirstRecordByFilter(
+		approvalVotesCollection, "pending_id = {:p} && voter_id = {:v}",
+		dbx.Params{"p": pendingID, "v": voterID},
+	)
+	if err == nil && existing != nil {
+		return ErrAlreadyVoted
+	}
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	collection, err := app.FindCollectionByNameOrId(approvalVotesCollection)
+	if err != nil {
+		return err
+	}
+	record := core.NewRecord(collection)
+	record.Set("pending_id", pendingID)
+	record.Set("voter_id", voterID)
+	record.Set("vote", vote)
+	record.Set("created_at", formatTime(time.Now()))
+	return app.Save(record)
+}
+
+// ListApprovalVotes returns the votes cast on a pending action, oldest first.
+func ListApprovalVotes(pendingID string) ([]*ApprovalVote, error) {
+	records, err := GetApp().FindRecordsByFilter(
+		approvalVotesCollection, "pending_id = {:p}", "+created_at", 0, 0,
+		dbx.Params{"p": pendingID},
+	)
+	if err != nil {
+		if isNotFound(err) {
+			return []*ApprovalVote{}, nil
+		}
+		return nil, err
+	}
+	out := make([]*ApprovalVote, 0, len(records))
+	for _, r := range records {
+		out = append(out, &ApprovalVote{
+			PendingID: r.GetString("pending_id"),
+			VoterID:   r.GetString("voter_id"),
+			Vote:      r.GetString("vote"),
+			CreatedAt: parseTime(r.GetString("created_at")),
+		})
+	}
+	return out, nil
+}
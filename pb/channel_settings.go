@@ -0,0 +1,65 @@
+package pb
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const channelSettingsCollection = "channel_settings"
+
+// Reasoning display modes: how the model's reasoning is shown in a channel.
+const (
+	ReasoningModeOff     = "off"     // never shown (default)
+	ReasoningModeSpoiler = "spoiler" // posted after the reply inside a spoiler
+	ReasoningModeButton  = "button"  // "Show reasoning" button, admins only
+)
+
+func normalizeReasoningMode(m string) string {
+	switch m {
+	case ReasoningModeSpoiler, ReasoningModeButton:
+		return m
+	default:
+		return ReasoningModeOff
+	}
+}
+
+// GetReasoningMode returns the channel's reasoning display mode (off if unset).
+func GetReasoningMode(channelID string) (string, error) {
+	record, err := findChannelSettings(channelID)
+	if err != nil || record == nil {
+		return ReasoningModeOff, err
+	}
+	return normalizeReasoningMode(record.GetString("reasoning_mode")), nil
+}
+
+// SetReasoningMode upserts the channel's reasoning display mode.
+func SetReasoningMode(channelID, mode string) error {
+	app := GetApp()
+	record, err := findChannelSettings(channelID)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		collection, cerr := app.FindCollectionByNameOrId(channelSettingsCollection)
+		if cerr != nil {
+			return cerr
+		}
+		record = core.NewRecord(collection)
+		record.Set("channel_id", channelID)
+	}
+	record.Set("reasoning_mode", normalizeReasoningMode(mode))
+	return app.Save(record)
+}
+
+func findChannelSettings(channelID string) (*core.Record, error) {
+	record, err := GetApp().FindFirstRecordByFilter(
+		channelSettingsCollection, "channel_id = {:c}", dbx.Params{"c": channelID},
+	)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return record, nil
+}
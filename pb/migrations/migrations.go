@@ -21,6 +21,18 @@ const (
 	serversCollection     = "servers"
 	mcpServersCollection  = "mcp_servers"
 	oauthTokensCollection = "oauth_tokens"
+
+	scheduledPromptsCollection = "scheduled_prompts"
+	channelSettingsCollection  = "channel_settings"
+	toolOutputsCollection      = "tool_outputs"
+	toolPoliciesCollection     = "tool_policies"
+	toolAuditCollection        = "tool_audit"
+	pendingActionsCollection   = "pending_actions"
+	approvalPoliciesCollection = "approval_policies"
+	approvalVotesCollection    = "approval_votes"
+	apiTokensCollection        = "api_tokens"
+	samplingUsageCollection    = "sampling_usage"
+	toolUsageCollection        = "tool_usage"
 )
 
 // Migration is a single schema/data change.
@@ -89,6 +101,228 @@ var list = []Migration{
 		Needed:   collectionMissing(oauthTokensCollection),
 		Apply:    createOAuthTokensCollection,
 	},
+	{
+		Name:     "create_scheduled_prompts_collection",
+		Optional: true,
+		Needed:   collectionMissing(scheduledPromptsCollection),
+		Apply:    createScheduledPromptsCollection,
+	},
+	{
+		Name:     "create_channel_settings_collection",
+		Optional: true,
+		Needed:   collectionMissing(channelSettingsCollection),
+		Apply:    createChannelSettingsCollection,
+	},
+	{
+		Name:     "create_tool_outputs_collection",
+		Optional: true,
+		Needed:   collectionMissing(toolOutputsCollection),
+		Apply:    createToolOutputsCollection,
+	},
+	{
+		Name:     "create_tool_policies_collection",
+		Optional: true,
+		Needed:   collectionMissing(toolPoliciesCollection),
+		Apply:    createToolPoliciesCollection,
+	},
+	{
+		Name:     "create_tool_audit_collection",
+		Optional: true,
+		Needed:   collectionMissing(toolAuditCollection),
+		Apply:    createToolAuditCollection,
+	},
+	{
+		Name:     "create_pending_actions_collection",
+		Optional: true,
+		Needed:   collectionMissing(pendingActionsCollection),
+		Apply:    createPendingActionsCollection,
+	},
+	{
+		Name:     "create_approval_policies_collection",
+		Optional: true,
+		Needed:   collectionMissing(approvalPoliciesCollection),
+		Apply:    createApprovalPoliciesCollection,
+	},
+	{
+		Name:     "create_approval_votes_collection",
+		Optional: true,
+		Needed:   collectionMissing(approvalVotesCollection),
+		Apply:    createApprovalVotesCollection,
+	},
+	{
+		Name:     "pending_add_required_approvals_field",
+		Optional: true,
+		Needed:   fieldMissing(pendingActionsCollection, "required_approvals"),
+		Apply:    addNumberField(pendingActionsCollection, "required_approvals"),
+	},
+	{
+		Name:     "pending_add_exclude_requester_field",
+		Optional: true,
+		Needed:   fieldMissing(pendingActionsCollection, "exclude_requester"),
+		Apply:    addBoolField(pendingActionsCollection, "exclude_requester"),
+	},
+	{
+		Name:     "pending_add_approver_roles_field",
+		Optional: true,
+		Needed:   fieldMissing(pendingActionsCollection, "approver_roles"),
+		Apply:    addTextField(pendingActionsCollection, "approver_roles"),
+	},
+	{
+		Name:     "pending_add_kind_field",
+		Optional: true,
+		Needed:   fieldMissing(pendingActionsCollection, "kind"),
+		Apply:    addTextField(pendingActionsCollection, "kind"),
+	},
+	{
+		Name:     "pending_add_prompt_channel_id_field",
+		Optional: true,
+		Needed:   fieldMissing(pendingActionsCollection, "prompt_channel_id"),
+		Apply:    addTextField(pendingActionsCollection, "prompt_channel_id"),
+	},
+	{
+		Name:     "create_api_tokens_collection",
+		Optional: true,
+		Needed:   collectionMissing(apiTokensCollection),
+		Apply:    createAPITokensCollection,
+	},
+	{
+		Name:     "mcp_add_transport_field",
+		Optional: true,
+		Needed:   fieldMissing(mcpServersCollection, "transport"),
+		Apply:    addTextField(mcpServersCollection, "transport"),
+	},
+	{
+		Name:     "mcp_add_command_field",
+		Optional: true,
+		Needed:   fieldMissing(mcpServersCollection, "command"),
+		Apply:    addTextField(mcpServersCollection, "command"),
+	},
+	{
+		Name:     "mcp_add_args_field",
+		Optional: true,
+		Needed:   fieldMissing(mcpServersCollection, "args"),
+		Apply:    addTextField(mcpServersCollection, "args"),
+	},
+	{
+		Name:     "mcp_add_env_field",
+		Optional: true,
+		Needed:   fieldMissing(mcpServersCollection, "env"),
+		Apply:    addTextField(mcpServersCollection, "env"),
+	},
+	{
+		Name:     "mcp_add_cwd_field",
+		Optional: true,
+		Needed:   fieldMissing(mcpServersCollection, "cwd"),
+		Apply:    addTextField(mcpServersCollection, "cwd"),
+	},
+	{
+		Name:     "mcp_url_optional",
+		Optional: true,
+		Needed:   mcpURLRequired,
+		Apply:    makeMCPURLOptional,
+	},
+	{
+		Name:     "mcp_add_last_error_field",
+		Optional: true,
+		Needed:   fieldMissing(mcpServersCollection, "last_error"),
+		Apply:    addTextField(mcpServersCollection, "last_error"),
+	},
+	{
+		Name:     "mcp_add_last_error_at_field",
+		Optional: true,
+		Needed:   fieldMissing(mcpServersCollection, "last_error_at"),
+		Apply:    addTextField(mcpServersCollection, "last_error_at"),
+	},
+	{
+		Name:     "mcp_add_last_connected_at_field",
+		Optional: true,
+		Needed:   fieldMissing(mcpServersCollection, "last_connected_at"),
+		Apply:    addTextField(mcpServersCollection, "last_connected_at"),
+	},
+	{
+		Name:     "mcp_add_latency_ms_field",
+		Optional: true,
+		Needed:   fieldMissing(mcpServersCollection, "latency_ms"),
+		Apply:    addNumberField(mcpServersCollection, "latency_ms"),
+	},
+	{
+		Name:     "oauth_add_client_id_field",
+		Optional: true,
+		Needed:   fieldMissing(oauthTokensCollection, "client_id"),
+		Apply:    addTextField(oauthTokensCollection, "client_id"),
+	},
+	{
+		Name:     "oauth_add_client_secret_field",
+		Optional: true,
+		Needed:   fieldMissing(oauthTokensCollection, "client_secret"),
+		Apply:    addTextField(oauthTokensCollection, "client_secret"),
+	},
+	{
+		Name:     "oauth_add_token_url_field",
+		Optional: true,
+		Needed:   fieldMissing(oauthTokensCollection, "token_url"),
+		Apply:    addTextField(oauthTokensCollection, "token_url"),
+	},
+	{
+		Name:     "oauth_add_auth_style_field",
+		Optional: true,
+		Needed:   fieldMissing(oauthTokensCollection, "auth_style"),
+		Apply:    addNumberField(oauthTokensCollection, "auth_style"),
+	},
+	{
+		Name:     "oauth_add_updated_at_field",
+		Optional: true,
+		Needed:   fieldMissing(oauthTokensCollection, "updated_at"),
+		Apply:    addTextField(oauthTokensCollection, "updated_at"),
+	},
+	{
+		Name:     "mcp_add_sampling_field",
+		Optional: true,
+		Needed:   fieldMissing(mcpServersCollection, "sampling"),
+		Apply:    addBoolField(mcpServersCollection, "sampling"),
+	},
+	{
+		Name:     "mcp_add_sampling_max_tokens_field",
+		Optional: true,
+		Needed:   fieldMissing(mcpServersCollection, "sampling_max_tokens"),
+		Apply:    addNumberField(mcpServersCollection, "sampling_max_tokens"),
+	},
+	{
+		Name:     "mcp_add_sampling_daily_tokens_field",
+		Optional: true,
+		Needed:   fieldMissing(mcpServersCollection, "sampling_daily_tokens"),
+		Apply:    addNumberField(mcpServersCollection, "sampling_daily_tokens"),
+	},
+	{
+		Name:     "mcp_add_sampling_approval_field",
+		Optional: true,
+		Needed:   fieldMissing(mcpServersCollection, "sampling_approval"),
+		Apply:    addBoolField(mcpServersCollection, "sampling_approval"),
+	},
+	{
+		Name:     "create_sampling_usage_collection",
+		Optional: true,
+		Needed:   collectionMissing(samplingUsageCollection),
+		Apply:    createSamplingUsageCollection,
+	},
+	{
+		Name:     "mcp_add_timeout_seconds_field",
+		Optional: true,
+		Needed:   fieldMissing(mcpServersCollection, "timeout_seconds"),
+		Apply:    addNumberField(mcpServersCollection, "timeout_seconds"),
+	},
+	{
+		Name:     "mcp_add_tool_timeouts_field",
+		Optional: true,
+		Needed:   fieldMissing(mcpServersCollection, "tool_timeouts"),
+		Apply:    addTextField(mcpServersCollection, "tool_timeouts"),
+	},
+	{
+		Name:     "create_tool_usage_collection",
+		Optional: true,
+		Needed:   collectionMissing(toolUsageCollection),
+		Apply:    createToolUsageCollection,
+	},
 }
 
 // Run applies every migration whose Needed check reports work to do, in order.
@@ -167,6 +401,17 @@ func addBoolField(collection, field string) func(core.App) error {
 	}
 }
 
+func addNumberField(collection, field string) func(core.App) error {
+	return func(app core.App) error {
+		c, err := app.FindCollectionByNameOrId(collection)
+		if err != nil {
+			return err
+		}
+		c.Fields.Add(&core.NumberField{Name: field, Required: false})
+		return app.SaveNoValidate(c)
+	}
+}
+
 // --- Collection creators ---
 
 func createRemindersCollection(app core.App) error {
@@ -218,6 +463,136 @@ func createOAuthTokensCollection(app core.App) error {
 	return app.Save(c)
 }
 
+// createScheduledPromptsCollection stores prompts that are run through the AI
+// chat loop on a schedule. Times use the same RFC3339 text encoding as reminders.
+func createScheduledPromptsCollection(app core.App) error {
+	c := core.NewBaseCollection(scheduledPromptsCollection, scheduledPromptsCollection)
+	c.Fields.Add(&core.TextField{Name: "user_id", Required: true})
+	c.Fields.Add(&core.TextField{Name: "channel_id", Required: true})
+	c.Fields.Add(&core.TextField{Name: "guild_id", Required: false})
+	c.Fields.Add(&core.TextField{Name: "prompt", Required: true})
+	c.Fields.Add(&core.TextField{Name: "schedule", Required: false})
+	c.Fields.Add(&core.BoolField{Name: "is_recurring", Required: false})
+	c.Fields.Add(&core.TextField{Name: "recurrence_rule", Required: false})
+	c.Fields.Add(&core.TextField{Name: "first_run_time", Required: false})
+	c.Fields.Add(&core.TextField{Name: "next_run_time", Required: false})
+	c.Fields.Add(&core.TextField{Name: "last_run_at", Required: false})
+	return app.Save(c)
+}
+
+// createChannelSettingsCollection stores per-channel bot settings (currently
+// how model reasoning is displayed).
+func createChannelSettingsCollection(app core.App) error {
+	c := core.NewBaseCollection(channelSettingsCollection, channelSettingsCollection)
+	c.Fields.Add(&core.TextField{Name: "channel_id", Required: true})
+	c.Fields.Add(&core.TextField{Name: "reasoning_mode", Required: false})
+	return app.Save(c)
+}
+
+// createToolOutputsCollection stores large tool results out-of-band; only a
+// preview and the record ID go into the chat history. The file is protected so
+// it is not downloadable through the public files API.
+func createToolOutputsCollection(app core.App) error {
+	c := core.NewBaseCollection(toolOutputsCollection, toolOutputsCollection)
+	c.Fields.Add(&core.TextField{Name: "user_id", Required: true})
+	c.Fields.Add(&core.TextField{Name: "channel_id", Required: false})
+	c.Fields.Add(&core.TextField{Name: "tool", Required: false})
+	c.Fields.Add(&core.NumberField{Name: "chars", Required: false})
+	c.Fields.Add(&core.FileField{Name: "file", MaxSelect: 1, MaxSize: 8 << 20, Protected: true})
+	c.Fields.Add(&core.TextField{Name: "created_at", Required: false})
+	return app.Save(c)
+}
+
+// createToolPoliciesCollection stores allow/deny rules for toolbelt tools per
+// Discord role, user, channel or guild.
+func createToolPoliciesCollection(app core.App) error {
+	c := core.NewBaseCollection(toolPoliciesCollection, toolPoliciesCollection)
+	c.Fields.Add(&core.TextField{Name: "effect", Required: true})
+	c.Fields.Add(&core.TextField{Name: "tool", Required: false})
+	c.Fields.Add(&core.TextField{Name: "server", Required: false})
+	c.Fields.Add(&core.TextField{Name: "subject_type", Required: true})
+	c.Fields.Add(&core.TextField{Name: "subject_id", Required: true})
+	c.Fields.Add(&core.TextField{Name: "created_by", Required: false})
+	return app.Save(c)
+}
+
+// createToolAuditCollection stores the append-only log of toolbelt tool
+// invocations. API rules stay nil (superusers only).
+func createToolAuditCollection(app core.App) error {
+	c := core.NewBaseCollection(toolAuditCollection, toolAuditCollection)
+	c.Fields.Add(&core.TextField{Name: "caller_id", Required: true})
+	c.Fields.Add(&core.TextField{Name: "approver_id", Required: false})
+	c.Fields.Add(&core.TextField{Name: "channel_id", Required: false})
+	c.Fields.Add(&core.TextField{Name: "guild_id", Required: false})
+	c.Fields.Add(&core.TextField{Name: "tool", Required: true})
+	c.Fields.Add(&core.TextField{Name: "server", Required: false})
+	c.Fields.Add(&core.TextField{Name: "args", Required: false})
+	c.Fields.Add(&core.TextField{Name: "status", Required: false})
+	c.Fields.Add(&core.NumberField{Name: "duration_ms", Required: false})
+	c.Fields.Add(&core.TextField{Name: "excerpt", Required: false})
+	c.Fields.Add(&core.TextField{Name: "created_at", Required: false})
+	c.AddIndex("idx_tool_audit_created_at", false, "created_at", "")
+	return app.Save(c)
+}
+
+// createPendingActionsCollection stores tool calls awaiting confirmation so
+// they survive restarts and expire.
+func createPendingActionsCollection(app core.App) error {
+	c := core.NewBaseCollection(pendingActionsCollection, pendingActionsCollection)
+	c.Fields.Add(&core.TextField{Name: "tool", Required: true})
+	c.Fields.Add(&core.TextField{Name: "source", Required: true})
+	c.Fields.Add(&core.TextField{Name: "args", Required: false, Max: 20000})
+	c.Fields.Add(&core.TextField{Name: "user_id", Required: true})
+	c.Fields.Add(&core.TextField{Name: "channel_id", Required: false})
+	c.Fields.Add(&core.TextField{Name: "guild_id", Required: false})
+	c.Fields.Add(&core.TextField{Name: "message_id", Required: false})
+	c.Fields.Add(&core.TextField{Name: "prompt", Required: false})
+	c.Fields.Add(&core.TextField{Name: "status", Required: true})
+	c.Fields.Add(&core.TextField{Name: "decided_by", Required: false})
+	c.Fields.Add(&core.TextField{Name: "outcome", Required: false})
+	c.Fields.Add(&core.TextField{Name: "expires_at", Required: false})
+	c.Fields.Add(&core.TextField{Name: "created_at", Required: false})
+	return app.Save(c)
+}
+
+// createApprovalPoliciesCollection stores approval rules for high-risk tools:
+// how many approvers, whether the requester may vote, and which roles may.
+func createApprovalPoliciesCollection(app core.App) error {
+	c := core.NewBaseCollection(approvalPoliciesCollection, approvalPoliciesCollection)
+	c.Fields.Add(&core.TextField{Name: "tool", Required: false})
+	c.Fields.Add(&core.TextField{Name: "server", Required: false})
+	c.Fields.Add(&core.NumberField{Name: "approvers_required", Required: false})
+	c.Fields.Add(&core.BoolField{Name: "exclude_requester", Required: false})
+	c.Fields.Add(&core.TextField{Name: "approver_roles", Required: false})
+	c.Fields.Add(&core.TextField{Name: "created_by", Required: false})
+	return app.Save(c)
+}
+
+// createApprovalVotesCollection records every vote cast on a pending action.
+func createApprovalVotesCollection(app core.App) error {
+	c := core.NewBaseCollection(approvalVotesCollection, approvalVotesCollection)
+	c.Fields.Add(&core.TextField{Name: "pending_id", Required: true})
+	c.Fields.Add(&core.TextField{Name: "voter_id", Required: true})
+	c.Fields.Add(&core.TextField{Name: "vote", Required: true})
+	c.Fields.Add(&core.TextField{Name: "created_at", Required: false})
+	c.AddIndex("idx_approval_votes_voter", true, "pending_id, voter_id", "")
+	return app.Save(c)
+}
+
+// createAPITokensCollection stores per-user tokens for bitbot's MCP endpoint,
+// as SHA-256 hashes. API rules stay nil (superusers only).
+func createAPITokensCollection(app core.App) error {
+	c := core.NewBaseCollection(apiTokensCollection, apiTokensCollection)
+	c.Fields.Add(&core.TextField{Name: "user_id", Required: true})
+	c.Fields.Add(&core.TextField{Name: "name", Required: false})
+	c.Fields.Add(&core.TextField{Name: "token_hash", Required: true})
+	c.Fields.Add(&core.TextField{Name: "hint", Required: false})
+	c.Fields.Add(&core.TextField{Name: "created_at", Required: false})
+	c.Fields.Add(&core.TextField{Name: "last_used_at", Required: false})
+	c.AddIndex("idx_api_tokens_hash", true, "token_hash", "")
+	return app.Save(c)
+}
+
 // --- Data migrations ---
 
 func mcpVisibilityBackfillNeeded(app core.App) (bool, error) {
@@ -260,3 +635,54 @@ func backfillMCPVisibility(app core.App) error {
 	}
 	return nil
 }
+
+func mcpURLRequired(app core.App) (bool, error) {
+	c, err := app.FindCollectionByNameOrId(mcpServersCollection)
+	if err != nil {
+		return false, nil
+	}
+	f, ok := c.Fields.GetByName("url").(*core.TextField)
+	return ok && f.Required, nil
+}
+
+// makeMCPURLOptional lets command (stdio) servers, which have no URL, be saved.
+func makeMCPURLOptional(app core.App) error {
+	c, err := app.FindCollectionByNameOrId(mcpServersCollection)
+	if err != nil {
+		return err
+	}
+	if f, ok := c.Fields.GetByName("url").(*core.TextField); ok {
+		f.Required = false
+	}
+	return app.SaveNoValidate(c)
+}
+
+// createSamplingUsageCollection records the completions MCP servers ran on the
+// bot's model, for token limits and accounting.
+func createSamplingUsageCollection(app core.App) error {
+	c := core.NewBaseCollection(samplingUsageCollection, samplingUsageCollection)
+	c.Fields.Add(&core.TextField{Name: "server", Required: true})
+	c.Fields.Add(&core.TextField{Name: "user_id", Required: false})
+	c.Fields.Add(&core.TextField{Name: "approver_id", Required: false})
+	c.Fields.Add(&core.TextField{Name: "model", Required: false})
+	c.Fields.Add(&core.NumberField{Name: "prompt_tokens", Required: false})
+	c.Fields.Add(&core.NumberField{Name: "completion_tokens", Required: false})
+	c.Fields.Add(&core.TextField{Name: "created_at", Required: false})
+	c.AddIndex("idx_sampling_usage_server_created_at", false, "server, created_at", "")
+	return app.Save(c)
+}
+
+// createToolUsageCollection counts each user's toolbelt tool calls per
+// channel, for pinning their most-used tools.
+func createToolUsageCollection(app core.App) error {
+	c := core.NewBaseCollection(toolUsageCollection, toolUsageCollection)
+	c.Fields.Add(&core.TextField{Name: "user_id", Required: true})
+	c.Fields.Add(&core.TextField{Name: "channel_id", Required: false})
+	c.Fields.Add(&core.TextField{Name: "server", Required: true})
+	c.Fields.Add(&core.TextField{Name: "tool", Required: true})
+	c.Fields.Add(&core.NumberField{Name: "uses", Required: false})
+	c.Fields.Add(&core.TextField{Name: "last_used_at", Required: false})
+	c.AddIndex("idx_tool_usage_key", true, "user_id, channel_id, server, tool", "")
+	c.AddIndex("idx_tool_usage_channel", false, "channel_id", "")
+	return app.Save(c)
+}
@@ -32,6 +32,13 @@ type UserToken struct {
 	TokenType    string
 	Expiry       time.Time
 	Scope        string
+
+	// The OAuth client the token was issued to, so it can be refreshed
+	// without the user. ClientSecret is encrypted at rest like the tokens.
+	ClientID     string
+	ClientSecret string
+	TokenURL     string
+	AuthStyle    int // oauth2.AuthStyle
 }
 
 // GetUserToken returns the stored token for a (user, server), or nil if none.
@@ -49,6 +56,10 @@ func GetUserToken(userID, server string) (*UserToken, error) {
 	if err != nil {
 		return nil, err
 	}
+	secret, err := decryptSecret(record.GetString("client_secret"))
+	if err != nil {
+		return nil, err
+	}
 	expiry, _ := time.Parse(time.RFC3339, record.GetString("expiry"))
 	return &UserToken{
 		UserID:       userID,
@@ -58,9 +69,30 @@ func GetUserToken(userID, server string) (*UserToken, error) {
 		TokenType:    record.GetString("token_type"),
 		Expiry:       expiry,
 		Scope:        record.GetString("scope"),
+		ClientID:     record.GetString("client_id"),
+		ClientSecret: secret,
+		TokenURL:     record.GetString("token_url"),
+		AuthStyle:    record.GetInt("auth_style"),
 	}, nil
 }
 
+// ListServerTokenUsers returns the users who linked a server (by serverKey),
+// most recently linked or refreshed first.
+func ListServerTokenUsers(server string) ([]string, error) {
+	records, err := GetApp().FindRecordsByFilter(oauthTokensCollection, "server = {:s}", "-updated_at", 0, 0, dbx.Params{"s": server})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	users := make([]string, 0, len(records))
+	for _, r := range records {
+		users = append(users, r.GetString("user_id"))
+	}
+	return users, nil
+}
+
 // SaveUserToken upserts a per-user token (create or update the existing row).
 // Access and refresh tokens are encrypted at rest with TOKEN_ENCRYPTION_KEY.
 func SaveUserToken(t *UserToken) error {
@@ -72,6 +104,10 @@ func SaveUserToken(t *UserToken) error {
 	if err != nil {
 		return err
 	}
+	secret, err := encryptSecret(t.ClientSecret)
+	if err != nil {
+		return err
+	}
 
 	app := GetApp()
 	record, err := findUserToken(t.UserID, t.Server)
@@ -96,6 +132,11 @@ func SaveUserToken(t *UserToken) error {
 		record.Set("expiry", t.Expiry.UTC().Format(time.RFC3339))
 	}
 	record.Set("scope", t.Scope)
+	record.Set("client_id", t.ClientID)
+	record.Set("client_secret", secret)
+	record.Set("token_url", t.TokenURL)
+	record.Set("auth_style", t.AuthStyle)
+	record.Set("updated_at", formatTime(time.Now()))
 	return app.Save(record)
 }
 
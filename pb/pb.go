@@ -113,6 +113,52 @@ type MCPServer struct {
 	Visibility string
 	// AuthMode is MCPAuth{Bearer,OAuth}: how the server authenticates.
 	AuthMode string
+	// Transport is MCPTransport{HTTP,Command}. Command servers are local
+	// processes spoken to over stdio, described by the fields below.
+	Transport string
+	Command   string
+	Args      []string
+	Env       []string // KEY=VALUE entries added to the process environment
+	Dir       string   // working directory; empty for the bot's own
+
+	// Health, as last seen by the bot.
+	LastError       string
+	LastErrorAt     time.Time
+	LastConnectedAt time.Time
+	Latency         time.Duration // round trip of the last successful ping
+
+	// Sampling lets the server ask the bot's model for completions.
+	Sampling            bool
+	SamplingMaxTokens   int  // per request; 0 for the bot's default
+	SamplingDailyTokens int  // over any 24 hours; 0 for no limit
+	SamplingApproval    bool // each request needs an admin's approval
+
+	// Timeout bounds how long a call of one of the server's tools may run, and
+	// ToolTimeouts overrides it per tool. Zero means the bot's default.
+	Timeout      time.Duration
+	ToolTimeouts map[string]time.Duration
+}
+
+// TimeoutFor returns how long a call of tool may run, or 0 for the bot's
+// default.
+func (s *MCPServer) TimeoutFor(tool string) time.Duration {
+	if d := s.ToolTimeouts[tool]; d > 0 {
+		return d
+	}
+	return s.Timeout
+}
+
+// MCP transports: how the bot reaches a server.
+const (
+	MCPTransportHTTP    = "http"    // Streamable HTTP at URL
+	MCPTransportCommand = "command" // a local process over stdio
+)
+
+func normalizeTransport(t string) string {
+	if t == MCPTransportCommand {
+		return MCPTransportCommand
+	}
+	return MCPTransportHTTP
 }
 
 const mcpServersCollection = "mcp_servers"
@@ -139,16 +185,7 @@ func ListMCPServers() ([]*MCPServer, error) {
 	}
 	servers := make([]*MCPServer, 0, len(records))
 	for _, r := range records {
-		servers = append(servers, &MCPServer{
-			ID:         r.Id,
-			Name:       r.GetString("name"),
-			URL:        r.GetString("url"),
-			Token:      r.GetString("token"),
-			Enabled:    r.GetBool("enabled"),
-			Owner:      r.GetString("owner"),
-			Visibility: normalizeVisibility(r.GetString("visibility")),
-			AuthMode:   normalizeAuthMode(r.GetString("auth_mode")),
-		})
+		servers = append(servers, recordToMCPServer(r))
 	}
 	return servers, nil
 }
@@ -184,6 +221,48 @@ func AddMCPServer(name, url, token, owner, visibility, authMode string) (bool, e
 	return true, nil
 }
 
+// AddMCPCommandServer inserts a new command (stdio) MCP server owned by owner:
+// a local process the bot starts and supervises. It is a no-op (returns false)
+// if the owner already has a server with that name.
+func AddMCPCommandServer(name, command string, args, env []string, dir, owner, visibility string) (bool, error) {
+	currentApp := GetApp()
+
+	if existing, _ := currentApp.FindFirstRecordByFilter(
+		mcpServersCollection, "name = {:name} && owner = {:owner}",
+		dbx.Params{"name": name, "owner": owner},
+	); existing != nil {
+		return false, nil
+	}
+
+	collection, err := currentApp.FindCollectionByNameOrId(mcpServersCollection)
+	if err != nil {
+		return false, err
+	}
+	argsJSON, err := json.Marshal(args)
+	if err != nil {
+		return false, err
+	}
+	envJSON, err := json.Marshal(env)
+	if err != nil {
+		return false, err
+	}
+	record := core.NewRecord(collection)
+	record.Set("name", name)
+	record.Set("enabled", true)
+	record.Set("owner", owner)
+	record.Set("visibility", normalizeVisibility(visibility))
+	record.Set("auth_mode", MCPAuthBearer)
+	record.Set("transport", MCPTransportCommand)
+	record.Set("command", command)
+	record.Set("args", string(argsJSON))
+	record.Set("env", string(envJSON))
+	record.Set("cwd", dir)
+	if err := currentApp.Save(record); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // GetMCPServer returns a server by (name, owner-or-legacy) for the given caller,
 // or nil if none matches.
 func GetMCPServer(name, caller string) (*MCPServer, error) {
@@ -191,16 +270,51 @@ func GetMCPServer(name, caller string) (*MCPServer, error) {
 	if record == nil {
 		return nil, nil
 	}
-	return &MCPServer{
-		ID:         record.Id,
-		Name:       record.GetString("name"),
-		URL:        record.GetString("url"),
-		Token:      record.GetString("token"),
-		Enabled:    record.GetBool("enabled"),
-		Owner:      record.GetString("owner"),
-		Visibility: normalizeVisibility(record.GetString("visibility")),
-		AuthMode:   normalizeAuthMode(record.GetString("auth_mode")),
-	}, nil
+	return recordToMCPServer(record), nil
+}
+
+func recordToMCPServer(r *core.Record) *MCPServer {
+	srv := &MCPServer{
+		ID:         r.Id,
+		Name:       r.GetString("name"),
+		URL:        r.GetString("url"),
+		Token:      r.GetString("token"),
+		Enabled:    r.GetBool("enabled"),
+		Owner:      r.GetString("owner"),
+		Visibility: normalizeVisibility(r.GetString("visibility")),
+		AuthMode:   normalizeAuthMode(r.GetString("auth_mode")),
+		Transport:  normalizeTransport(r.GetString("transport")),
+		Command:    r.GetString("command"),
+		Dir:        r.GetString("cwd"),
+
+		LastError:       r.GetString("last_error"),
+		LastErrorAt:     parseTime(r.GetString("last_error_at")),
+		LastConnectedAt: parseTime(r.GetString("last_connected_at")),
+		Latency:         time.Duration(r.GetInt("latency_ms")) * time.Millisecond,
+
+		Sampling:            r.GetBool("sampling"),
+		SamplingMaxTokens:   r.GetInt("sampling_max_tokens"),
+		SamplingDailyTokens: r.GetInt("sampling_daily_tokens"),
+		SamplingApproval:    r.GetBool("sampling_approval"),
+
+		Timeout: time.Duration(r.GetInt("timeout_seconds")) * time.Second,
+	}
+	if v := r.GetString("args"); v != "" {
+		_ = json.Unmarshal([]byte(v), &srv.Args)
+	}
+	if v := r.GetString("env"); v != "" {
+		_ = json.Unmarshal([]byte(v), &srv.Env)
+	}
+	if v := r.GetString("tool_timeouts"); v != "" {
+		var seconds map[string]int
+		if json.Unmarshal([]byte(v), &seconds) == nil && len(seconds) > 0 {
+			srv.ToolTimeouts = make(map[string]time.Duration, len(seconds))
+			for tool, n := range seconds {
+				srv.ToolTimeouts[tool] = time.Duration(n) * time.Second
+			}
+		}
+	}
+	return srv
 }
 
 // findOwnedOrLegacy locates a server by name that the caller may manage: one they
@@ -239,6 +353,67 @@ func SetMCPServerVisibility(name, caller, visibility string) (bool, error) {
 	return true, nil
 }
 
+// SetMCPServerSampling updates the sampling settings of a server the caller
+// may manage. It returns false if there is no such server.
+func SetMCPServerSampling(name, caller string, enabled bool, maxTokens, dailyTokens int, approval bool) (bool, error) {
+	record := findOwnedOrLegacy(name, caller)
+	if record == nil {
+		return false, nil
+	}
+	record.Set("sampling", enabled)
+	record.Set("sampling_max_tokens", maxTokens)
+	record.Set("sampling_daily_tokens", dailyTokens)
+	record.Set("sampling_approval", approval)
+	if err := GetApp().Save(record); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SetMCPServerTimeout sets how long calls of a server's tools may run: of tool,
+// or of every tool without its own timeout when tool is "". Zero seconds
+// clears it. It returns false if the caller may not manage such a server.
+func SetMCPServerTimeout(name, caller, tool string, seconds int) (bool, error) {
+	record := findOwnedOrLegacy(name, caller)
+	if record == nil {
+		return false, nil
+	}
+	if tool == "" {
+		record.Set("timeout_seconds", seconds)
+	} else {
+		timeouts := map[string]int{}
+		if v := record.GetString("tool_timeouts"); v != "" {
+			_ = json.Unmarshal([]byte(v), &timeouts)
+		}
+		if seconds > 0 {
+			timeouts[tool] = seconds
+		} else {
+			delete(timeouts, tool)
+		}
+		b, err := json.Marshal(timeouts)
+		if err != nil {
+			return false, err
+		}
+		record.Set("tool_timeouts", string(b))
+	}
+	if err := GetApp().Save(record); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetMCPServerByID returns a server by record ID, or nil if it is gone.
+func GetMCPServerByID(id string) (*MCPServer, error) {
+	record, err := GetApp().FindRecordById(mcpServersCollection, id)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return recordToMCPServer(record), nil
+}
+
 // RemoveMCPServer deletes a server the caller may manage. Not-found is a no-op.
 func RemoveMCPServer(name, caller string) error {
 	record := findOwnedOrLegacy(name, caller)
@@ -248,6 +423,46 @@ func RemoveMCPServer(name, caller string) error {
 	return GetApp().Delete(record)
 }
 
+// RecordMCPServerConnected notes that the bot connected to a server, clearing
+// its last error.
+func RecordMCPServerConnected(id string) error {
+	return updateMCPServer(id, func(r *core.Record) {
+		r.Set("last_connected_at", formatTime(time.Now()))
+		r.Set("last_error", "")
+	})
+}
+
+// RecordMCPServerLatency stores the round trip of a successful ping.
+func RecordMCPServerLatency(id string, latency time.Duration) error {
+	return updateMCPServer(id, func(r *core.Record) {
+		r.Set("latency_ms", latency.Milliseconds())
+	})
+}
+
+// RecordMCPServerError stores why connecting to or pinging a server failed.
+func RecordMCPServerError(id, message string) error {
+	return updateMCPServer(id, func(r *core.Record) {
+		r.Set("last_error", message)
+		r.Set("last_error_at", formatTime(time.Now()))
+	})
+}
+
+func updateMCPServer(id string, update func(*core.Record)) error {
+	if id == "" {
+		return nil
+	}
+	app := GetApp()
+	record, err := app.FindRecordById(mcpServersCollection, id)
+	if err != nil {
+		if isNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	update(record)
+	return app.Save(record)
+}
+
 // GetApp is a helper to ensure pbApp is initialized.
 func GetApp() *pocketbase.PocketBase {
 	if pbApp == nil {
@@ -0,0 +1,265 @@
+package pb
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const pendingActionsCollection = "pending_actions"
+
+// Pending action statuses.
+const (
+	PendingStatusPending   = "pending"
+	PendingStatusApproved  = "approved"
+	PendingStatusCancelled = "cancelled"
+	PendingStatusExpired   = "expired"
+)
+
+// Pending action kinds. A confirmation is a call the requester may make that
+// needs approval; an access request is a call of a tool the requester may not
+// use, which runs only if an admin grants it.
+const (
+	PendingKindConfirm = ""
+	PendingKindAccess  = "access"
+)
+
+// ErrPendingHandled is returned by ClaimPendingAction when the action was
+// already decided or has expired.
+var ErrPendingHandled = errors.New("pending action already handled or expired")
+
+// PendingAction is a tool call waiting for confirmation. It is persisted so
+// confirmations survive restarts and can expire.
+type PendingAction struct {
+	ID        string
+	Tool      string // registered tool name
+	Source    string // registered tool source ("local" or owner/server)
+	Args      string // JSON arguments
+	UserID    string // who requested it
+	ChannelID string
+	GuildID   string
+	MessageID string // the Confirm/Cancel prompt message
+	Prompt    string // the prompt message's text, for editing it later
+	Status    string
+	DecidedBy string
+	Outcome   string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+
+	// Approval rule captured when the action was requested (see
+	// ApprovalPolicy). RequiredApprovals is at least 1.
+	RequiredApprovals int
+	ExcludeRequester  bool
+	ApproverRoles     string
+
+	// Kind is PendingKindConfirm or PendingKindAccess. PromptChannelID is
+	// where the prompt was posted when that is not ChannelID (e.g. an
+	// admin's DMs for an access request).
+	Kind            string
+	PromptChannelID string
+}
+
+// claimMu serializes claims so two clicks cannot both win.
+var claimMu sync.Mutex
+
+// CreatePendingAction saves a new pending action and sets its ID.
+func CreatePendingAction(p *PendingAction) error {
+	app := GetApp()
+	collection, err := app.FindCollectionByNameOrId(pendingActionsCollection)
+	if err != nil {
+		return err
+	}
+	if p.CreatedAt.IsZero() {
+		p.CreatedAt = time.Now()
+	}
+	p.Status = PendingStatusPending
+	record := core.NewRecord(collection)
+	record.Set("tool", p.Tool)
+	record.Set("source", p.Source)
+	record.Set("args", p.Args)
+	record.Set("user_id", p.UserID)
+	record.Set("channel_id", p.ChannelID)
+	record.Set("guild_id", p.GuildID)
+	record.Set("message_id", p.MessageID)
+	record.Set("prompt_channel_id", p.PromptChannelID)
+	record.Set("kind", p.Kind)
+	record.Set("prompt", p.Prompt)
+	record.Set("status", p.Status)
+	record.Set("expires_at", formatTime(p.ExpiresAt))
+	record.Set("created_at", formatTime(p.CreatedAt))
+	record.Set("required_approvals", max(p.RequiredApprovals, 1))
+	record.Set("exclude_requester", p.ExcludeRequester)
+	record.Set("approver_roles", p.ApproverRoles)
+	if err := app.Save(record); err != nil {
+		return err
+	}
+	p.ID = record.Id
+	return nil
+}
+
+// GetPendingAction returns a pending action by ID.
+func GetPendingAction(id string) (*PendingAction, error) {
+	record, err := GetApp().FindRecordById(pendingActionsCollection, id)
+	if err != nil {
+		return nil, err
+	}
+	return recordToPendingAction(record), nil
+}
+
+// PromptChannel returns the channel holding the action's prompt message.
+func (p *PendingAction) PromptChannel() string {
+	if p.PromptChannelID != "" {
+		return p.PromptChannelID
+	}
+	return p.ChannelID
+}
+
+// SetPendingActionMessage records the prompt message of a pending action.
+func SetPendingActionMessage(id, messageID, prompt string) error {
+	app := GetApp()
+	record, err := app.FindRecordById(pendingActionsCollection, id)
+	if err != nil {
+		return err
+	}
+	record.Set("message_id", messageID)
+	record.Set("prompt", prompt)
+	return app.Save(record)
+}
+
+// ClaimPendingAction moves a still-pending, unexpired action to status (approved
+// or cancelled), decided by decidedBy, and returns it. It returns
+// ErrPendingHandled if the action was already decided; an action found expired
+// is marked expired and also reported as ErrPendingHandled.
+func ClaimPendingAction(id, status, decidedBy string) (*PendingAction, error) {
+	claimMu.Lock()
+	defer claimMu.Unlock()
+	app := GetApp()
+	record, err := app.FindRecordById(pendingActionsCollection, id)
+	if err != nil {
+		return nil, err
+	}
+	p := recordToPendingAction(record)
+	if p.Status != PendingStatusPending {
+		return p, ErrPendingHandled
+	}
+	if !p.ExpiresAt.IsZero() && time.Now().After(p.ExpiresAt) {
+		record.Set("status", PendingStatusExpired)
+		_ = app.Save(record)
+		p.Status = PendingStatusExpired
+		return p, ErrPendingHandled
+	}
+	record.Set("status", status)
+	record.Set("decided_by", decidedBy)
+	if err := app.Save(record); err != nil {
+		return nil, err
+	}
+	p.Status, p.DecidedBy = status, decidedBy
+	return p, nil
+}
+
+// SetPendingActionOutcome records the result of a decided action.
+func SetPendingActionOutcome(id, outcome string) error {
+	app := GetApp()
+	record, err := app.FindRecordById(pendingActionsCollection, id)
+	if err != nil {
+		return err
+	}
+	record.Set("outcome", outcome)
+	return app.Save(record)
+}
+
+// DeletePendingAction deletes a pending action. Not-found is a no-op.
+func DeletePendingAction(id string) error {
+	app := GetApp()
+	record, err := app.FindRecordById(pendingActionsCollection, id)
+	if err != nil {
+		if isNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	return app.Delete(record)
+}
+
+// ListPendingActions returns actions still awaiting a decision, oldest first.
+// A non-empty userID limits the list to that requester.
+func ListPendingActions(userID string) ([]*PendingAction, error) {
+	filter := "status = {:status} && expires_at > {:now}"
+	params := dbx.Params{"status": PendingStatusPending, "now": formatTime(time.Now())}
+	if userID != "" {
+		filter += " && user_id = {:user}"
+		params["user"] = userID
+	}
+	records, err := GetApp().FindRecordsByFilter(pendingActionsCollection, filter, "+created_at", 50, 0, params)
+	if err != nil {
+		if isNotFound(err) {
+			return []*PendingAction{}, nil
+		}
+		return nil, err
+	}
+	return recordsToPendingActions(records), nil
+}
+
+// ExpirePendingActions marks every pending action past its expiry as expired
+// and returns them.
+func ExpirePendingActions() ([]*PendingAction, error) {
+	claimMu.Lock()
+	defer claimMu.Unlock()
+	app := GetApp()
+	records, err := app.FindRecordsByFilter(
+		pendingActionsCollection, "status = {:status} && expires_at != '' && expires_at <= {:now}", "", 100, 0,
+		dbx.Params{"status": PendingStatusPending, "now": formatTime(time.Now())},
+	)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	out := make([]*PendingAction, 0, len(records))
+	for _, r := range records {
+		r.Set("status", PendingStatusExpired)
+		if err := app.Save(r); err != nil {
+			return out, err
+		}
+		out = append(out, recordToPendingAction(r))
+	}
+	return out, nil
+}
+
+func recordsToPendingActions(records []*core.Record) []*PendingAction {
+	out := make([]*PendingAction, 0, len(records))
+	for _, r := range records {
+		out = append(out, recordToPendingAction(r))
+	}
+	return out
+}
+
+func recordToPendingAction(r *core.Record) *PendingAction {
+	return &PendingAction{
+		ID:        r.Id,
+		Tool:      r.GetString("tool"),
+		Source:    r.GetString("source"),
+		Args:      r.GetString("args"),
+		UserID:    r.GetString("user_id"),
+		ChannelID: r.GetString("channel_id"),
+		GuildID:   r.GetString("guild_id"),
+		MessageID: r.GetString("message_id"),
+		Prompt:    r.GetString("prompt"),
+		Status:    r.GetString("status"),
+		DecidedBy: r.GetString("decided_by"),
+		Outcome:   r.GetString("outcome"),
+		ExpiresAt: parseTime(r.GetString("expires_at")),
+		CreatedAt: parseTime(r.GetString("created_at")),
+
+		RequiredApprovals: max(r.GetInt("required_approvals"), 1),
+		ExcludeRequester:  r.GetBool("exclude_requester"),
+		ApproverRoles:     r.GetString("approver_roles"),
+
+		Kind:            r.GetString("kind"),
+		PromptChannelID: r.GetString("prompt_channel_id"),
+	}
+}
@@ -0,0 +1,61 @@
+package pb
+
+import (
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const samplingUsageCollection = "sampling_usage"
+
+// SamplingUsage is one completion an MCP server ran on the bot's model.
+type SamplingUsage struct {
+	Server           string // serverKey of the MCP server
+	UserID           string // user whose tool call the request came during, if known
+	ApproverID       string // admin who approved it, if approval was required
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	CreatedAt        time.Time
+}
+
+// RecordSamplingUsage appends a usage entry.
+func RecordSamplingUsage(u *SamplingUsage) error {
+	app := GetApp()
+	collection, err := app.FindCollectionByNameOrId(samplingUsageCollection)
+	if err != nil {
+		return err
+	}
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = time.Now()
+	}
+	record := core.NewRecord(collection)
+	record.Set("server", u.Server)
+	record.Set("user_id", u.UserID)
+	record.Set("approver_id", u.ApproverID)
+	record.Set("model", u.Model)
+	record.Set("prompt_tokens", u.PromptTokens)
+	record.Set("completion_tokens", u.CompletionTokens)
+	record.Set("created_at", formatTime(u.CreatedAt))
+	return app.Save(record)
+}
+
+// SamplingTokensSince returns how many tokens (prompt and completion) a
+// server's sampling requests used since the given time.
+func SamplingTokensSince(server string, since time.Time) (int, error) {
+	records, err := GetApp().FindRecordsByFilter(samplingUsageCollection,
+		"server = {:server} && created_at >= {:since}", "", 0, 0,
+		dbx.Params{"server": server, "since": formatTime(since)})
+	if err != nil {
+		if isNotFound(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	total := 0
+	for _, r := range records {
+		total += r.GetInt("prompt_tokens") + r.GetInt("completion_tokens")
+	}
+	return total, nil
+}
@@ -0,0 +1,169 @@
+package pb
+
+import (
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const scheduledPromptsCollection = "scheduled_prompts"
+
+// ScheduledPrompt is a prompt that is run through the AI chat loop on a
+// schedule, as the user who created it, with the reply posted to ChannelID.
+type ScheduledPrompt struct {
+	ID        string
+	UserID    string
+	ChannelID string
+	GuildID   string
+	Prompt    string
+	// Schedule is the "when" expression the user gave (e.g. "every weekday at
+	// 9am"), kept for display.
+	Schedule       string
+	IsRecurring    bool
+	RecurrenceRule string
+	// FirstRunTime anchors recurrence (time of day, interval base).
+	FirstRunTime time.Time
+	NextRunTime  time.Time
+	LastRunAt    time.Time
+}
+
+// CreateScheduledPrompt saves a new scheduled prompt and sets its ID.
+func CreateScheduledPrompt(p *ScheduledPrompt) error {
+	app := GetApp()
+	collection, err := app.FindCollectionByNameOrId(scheduledPromptsCollection)
+	if err != nil {
+		return err
+	}
+	record := core.NewRecord(collection)
+	record.Set("user_id", p.UserID)
+	record.Set("channel_id", p.ChannelID)
+	record.Set("guild_id", p.GuildID)
+	record.Set("prompt", p.Prompt)
+	record.Set("schedule", p.Schedule)
+	record.Set("is_recurring", p.IsRecurring)
+	record.Set("recurrence_rule", p.RecurrenceRule)
+	record.Set("first_run_time", formatTime(p.FirstRunTime))
+	record.Set("next_run_time", formatTime(p.NextRunTime))
+	if err := app.Save(record); err != nil {
+		return err
+	}
+	p.ID = record.Id
+	return nil
+}
+
+// GetDueScheduledPrompts returns prompts whose next run time has passed.
+func GetDueScheduledPrompts() ([]*ScheduledPrompt, error) {
+	records, err := GetApp().FindRecordsByFilter(
+		scheduledPromptsCollection,
+		"next_run_time != '' && next_run_time <= {:now}",
+		"+next_run_time",
+		50,
+		0,
+		dbx.Params{"now": formatTime(time.Now())},
+	)
+	if err != nil {
+		if isNotFound(err) {
+			return []*ScheduledPrompt{}, nil
+		}
+		return nil, err
+	}
+	return recordsToScheduledPrompts(records), nil
+}
+
+// ListScheduledPromptsByUser returns every scheduled prompt created by userID.
+func ListScheduledPromptsByUser(userID string) ([]*ScheduledPrompt, error) {
+	records, err := GetApp().FindRecordsByFilter(
+		scheduledPromptsCollection, "user_id = {:userID}", "+next_run_time", 0, 0,
+		dbx.Params{"userID": userID},
+	)
+	if err != nil {
+		if isNotFound(err) {
+			return []*ScheduledPrompt{}, nil
+		}
+		return nil, err
+	}
+	return recordsToScheduledPrompts(records), nil
+}
+
+// GetScheduledPromptByID returns a scheduled prompt by its record ID.
+func GetScheduledPromptByID(id string) (*ScheduledPrompt, error) {
+	record, err := GetApp().FindRecordById(scheduledPromptsCollection, id)
+	if err != nil {
+		return nil, err
+	}
+	return recordToScheduledPrompt(record), nil
+}
+
+// UpdateScheduledPromptRun records a run: the next run time and when it last ran.
+func UpdateScheduledPromptRun(id string, next, lastRun time.Time) error {
+	app := GetApp()
+	record, err := app.FindRecordById(scheduledPromptsCollection, id)
+	if err != nil {
+		return err
+	}
+	record.Set("next_run_time", formatTime(next))
+	record.Set("last_run_at", formatTime(lastRun))
+	return app.Save(record)
+}
+
+// DeleteScheduledPrompt deletes a scheduled prompt. Not-found is a no-op.
+func DeleteScheduledPrompt(id string) error {
+	app := GetApp()
+	record, err := app.FindRecordById(scheduledPromptsCollection, id)
+	if err != nil {
+		if isNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	return app.Delete(record)
+}
+
+func recordsToScheduledPrompts(records []*core.Record) []*ScheduledPrompt {
+	out := make([]*ScheduledPrompt, 0, len(records))
+	for _, r := range records {
+		out = append(out, recordToScheduledPrompt(r))
+	}
+	return out
+}
+
+func recordToScheduledPrompt(r *core.Record) *ScheduledPrompt {
+	return &ScheduledPrompt{
+		ID:             r.Id,
+		UserID:         r.GetString("user_id"),
+		ChannelID:      r.GetString("channel_id"),
+		GuildID:        r.GetString("guild_id"),
+		Prompt:         r.GetString("prompt"),
+		Schedule:       r.GetString("schedule"),
+		IsRecurring:    r.GetBool("is_recurring"),
+		RecurrenceRule: r.GetString("recurrence_rule"),
+		FirstRunTime:   parseTime(r.GetString("first_run_time")),
+		NextRunTime:    parseTime(r.GetString("next_run_time")),
+		LastRunAt:      parseTime(r.GetString("last_run_at")),
+	}
+}
+
+// formatTime stores t as an RFC3339Nano UTC string (the format the reminders
+// collection uses), or "" for the zero time.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// parseTime reverses formatTime, returning the zero time for empty or invalid
+// values.
+func parseTime(s string) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		log.Warn("Failed to parse stored time", "value", s, "error", err)
+		return time.Time{}
+	}
+	return t.In(reminderLocation)
+}
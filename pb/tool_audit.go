@@ -0,0 +1,116 @@
+package pb
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const toolAuditCollection = "tool_audit"
+
+// ToolAuditEntry is one toolbelt tool invocation. Entries are only ever
+// appended; the bot never updates or deletes them.
+type ToolAuditEntry struct {
+	ID         string
+	CallerID   string // user whose request the tool ran for
+	ApproverID string // who approved it (comma-separated when several), if it needed confirmation
+	ChannelID  string
+	GuildID    string
+	Tool       string
+	Server     string // "local" or the MCP server name
+	Args       string // JSON, with secret-looking values redacted
+	Status     string // "success" or "error"
+	DurationMS int64
+	Excerpt    string // start of the result
+	CreatedAt  time.Time
+}
+
+// ToolAuditFilter narrows QueryToolAudit; zero fields match everything.
+type ToolAuditFilter struct {
+	UserID string // matches the caller or any approver
+	Tool   string
+	Since  time.Time
+	Until  time.Time
+}
+
+// RecordToolAudit appends an audit entry.
+func RecordToolAudit(e *ToolAuditEntry) error {
+	app := GetApp()
+	collection, err := app.FindCollectionByNameOrId(toolAuditCollection)
+	if err != nil {
+		return err
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	record := core.NewRecord(collection)
+	record.Set("caller_id", e.CallerID)
+	record.Set("approver_id", e.ApproverID)
+	record.Set("channel_id", e.ChannelID)
+	record.Set("guild_id", e.GuildID)
+	record.Set("tool", e.Tool)
+	record.Set("server", e.Server)
+	record.Set("args", e.Args)
+	record.Set("status", e.Status)
+	record.Set("duration_ms", e.DurationMS)
+	record.Set("excerpt", e.Excerpt)
+	record.Set("created_at", formatTime(e.CreatedAt))
+	if err := app.Save(record); err != nil {
+		return err
+	}
+	e.ID = record.Id
+	return nil
+}
+
+// QueryToolAudit returns up to limit matching entries, newest first.
+func QueryToolAudit(f ToolAuditFilter, limit int) ([]*ToolAuditEntry, error) {
+	var conds []string
+	params := dbx.Params{}
+	if f.UserID != "" {
+		conds = append(conds, "(caller_id = {:user} || approver_id ~ {:user})")
+		params["user"] = f.UserID
+	}
+	if f.Tool != "" {
+		conds = append(conds, "tool = {:tool}")
+		params["tool"] = f.Tool
+	}
+	if !f.Since.IsZero() {
+		conds = append(conds, "created_at >= {:since}")
+		params["since"] = formatTime(f.Since)
+	}
+	if !f.Until.IsZero() {
+		conds = append(conds, "created_at <= {:until}")
+		params["until"] = formatTime(f.Until)
+	}
+	filter := strings.Join(conds, " && ")
+	if filter == "" {
+		filter = "id != ''"
+	}
+	records, err := GetApp().FindRecordsByFilter(toolAuditCollection, filter, "-created_at", limit, 0, params)
+	if err != nil {
+		if isNotFound(err) {
+			return []*ToolAuditEntry{}, nil
+		}
+		return nil, err
+	}
+	out := make([]*ToolAuditEntry, 0, len(records))
+	for _, r := range records {
+		out = append(out, &ToolAuditEntry{
+			ID:         r.Id,
+			CallerID:   r.GetString("caller_id"),
+			ApproverID: r.GetString("approver_id"),
+			ChannelID:  r.GetString("channel_id"),
+			GuildID:    r.GetString("guild_id"),
+			Tool:       r.GetString("tool"),
+			Server:     r.GetString("server"),
+			Args:       r.GetString("args"),
+			Status:     r.GetString("status"),
+			DurationMS: int64(r.GetInt("duration_ms")),
+			Excerpt:    r.GetString("excerpt"),
+			CreatedAt:  parseTime(r.GetString("created_at")),
+		})
+	}
+	return out, nil
+}
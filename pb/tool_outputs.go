@@ -0,0 +1,125 @@
+package pb
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+const toolOutputsCollection = "tool_outputs"
+
+// MaxToolOutputSize is the largest tool result stored, in bytes (it matches the
+// collection's file size limit and stays under Discord's attachment limit).
+const MaxToolOutputSize = 8 << 20
+
+// ToolOutput is a large tool result stored as a file, referenced from chat
+// history by ID.
+type ToolOutput struct {
+	ID        string
+	UserID    string // the user whose call produced it; only they (or an admin) may read it
+	ChannelID string
+	Tool      string
+	Chars     int // length of the full result in characters (runes)
+	CreatedAt time.Time
+}
+
+// SaveToolOutput stores content (at most MaxToolOutputSize bytes) and returns
+// its metadata.
+func SaveToolOutput(userID, channelID, tool, content string, chars int) (*ToolOutput, error) {
+	if len(content) > MaxToolOutputSize {
+		return nil, fmt.Errorf("tool output is %d bytes, over the %d byte limit", len(content), MaxToolOutputSize)
+	}
+	app := GetApp()
+	collection, err := app.FindCollectionByNameOrId(toolOutputsCollection)
+	if err != nil {
+		return nil, err
+	}
+	file, err := filesystem.NewFileFromBytes([]byte(content), "output.txt")
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	record := core.NewRecord(collection)
+	record.Set("user_id", userID)
+	record.Set("channel_id", channelID)
+	record.Set("tool", tool)
+	record.Set("chars", chars)
+	record.Set("file", file)
+	record.Set("created_at", formatTime(now))
+	if err := app.Save(record); err != nil {
+		return nil, err
+	}
+	return recordToToolOutput(record), nil
+}
+
+// GetToolOutput returns a stored tool output's metadata.
+func GetToolOutput(id string) (*ToolOutput, error) {
+	record, err := GetApp().FindRecordById(toolOutputsCollection, id)
+	if err != nil {
+		return nil, err
+	}
+	return recordToToolOutput(record), nil
+}
+
+// ReadToolOutput returns the full content of a stored tool output.
+func ReadToolOutput(id string) (string, error) {
+	app := GetApp()
+	record, err := app.FindRecordById(toolOutputsCollection, id)
+	if err != nil {
+		return "", err
+	}
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		return "", err
+	}
+	defer fsys.Close()
+	r, err := fsys.GetReader(record.BaseFilesPath() + "/" + record.GetString("file"))
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// DeleteToolOutputsBefore deletes outputs created before t (their files are
+// removed with the records) and returns how many were deleted.
+func DeleteToolOutputsBefore(t time.Time) (int, error) {
+	app := GetApp()
+	records, err := app.FindRecordsByFilter(
+		toolOutputsCollection, "created_at < {:t}", "", 200, 0,
+		dbx.Params{"t": formatTime(t)},
+	)
+	if err != nil {
+		if isNotFound(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	deleted := 0
+	for _, r := range records {
+		if err := app.Delete(r); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+func recordToToolOutput(r *core.Record) *ToolOutput {
+	return &ToolOutput{
+		ID:        r.Id,
+		UserID:    r.GetString("user_id"),
+		ChannelID: r.GetString("channel_id"),
+		Tool:      r.GetString("tool"),
+		Chars:     r.GetInt("chars"),
+		CreatedAt: parseTime(r.GetString("created_at")),
+	}
+}
@@ -0,0 +1,90 @@
+package pb
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const toolPoliciesCollection = "tool_policies"
+
+// Tool policy effects.
+const (
+	PolicyAllow = "allow" // grants access to an admins-visibility tool
+	PolicyDeny  = "deny"  // blocks access; deny always wins
+)
+
+// Tool policy subject types: who a policy applies to.
+const (
+	PolicySubjectRole    = "role"
+	PolicySubjectUser    = "user"
+	PolicySubjectChannel = "channel"
+	PolicySubjectGuild   = "guild"
+)
+
+// ToolPolicy allows or denies toolbelt tools for a Discord role, user, channel
+// or guild. Tool is an exact tool name or a path.Match glob, Server is an MCP
+// server name ("local" for built-in tools); an empty Tool or Server matches
+// any, but at least one of them is set.
+type ToolPolicy struct {
+	ID          string
+	Effect      string
+	Tool        string
+	Server      string
+	SubjectType string
+	SubjectID   string
+	CreatedBy   string
+}
+
+// ListToolPolicies returns every tool policy.
+func ListToolPolicies() ([]*ToolPolicy, error) {
+	records, err := GetApp().FindAllRecords(toolPoliciesCollection)
+	if err != nil {
+		if isNotFound(err) {
+			return []*ToolPolicy{}, nil
+		}
+		return nil, err
+	}
+	out := make([]*ToolPolicy, 0, len(records))
+	for _, r := range records {
+		out = append(out, &ToolPolicy{
+			ID:          r.Id,
+			Effect:      r.GetString("effect"),
+			Tool:        r.GetString("tool"),
+			Server:      r.GetString("server"),
+			SubjectType: r.GetString("subject_type"),
+			SubjectID:   r.GetString("subject_id"),
+			CreatedBy:   r.GetString("created_by"),
+		})
+	}
+	return out, nil
+}
+
+// CreateToolPolicy saves a new tool policy and sets its ID.
+func CreateToolPolicy(p *ToolPolicy) error {
+	app := GetApp()
+	collection, err := app.FindCollectionByNameOrId(toolPoliciesCollection)
+	if err != nil {
+		return err
+	}
+	record := core.NewRecord(collection)
+	record.Set("effect", p.Effect)
+	record.Set("tool", p.Tool)
+	record.Set("server", p.Server)
+	record.Set("subject_type", p.SubjectType)
+	record.Set("subject_id", p.SubjectID)
+	record.Set("created_by", p.CreatedBy)
+	if err := app.Save(record); err != nil {
+		return err
+	}
+	p.ID = record.Id
+	return nil
+}
+
+// DeleteToolPolicy deletes a tool policy by ID.
+func DeleteToolPolicy(id string) error {
+	app := GetApp()
+	record, err := app.FindRecordById(toolPoliciesCollection, id)
+	if err != nil {
+		return err
+	}
+	return app.Delete(record)
+}
@@ -0,0 +1,77 @@
+package pb
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const toolUsageCollection = "tool_usage"
+
+// ToolUse counts one user's calls of a toolbelt tool in one channel.
+type ToolUse struct {
+	UserID     string
+	ChannelID  string
+	Server     string // "local" or the MCP server name
+	Tool       string
+	Uses       int
+	LastUsedAt time.Time
+}
+
+// toolUsageMu serializes increments, so concurrent calls aren't lost.
+var toolUsageMu sync.Mutex
+
+// RecordToolUse counts a call of server/tool by userID in channelID.
+func RecordToolUse(userID, channelID, server, tool string) error {
+	toolUsageMu.Lock()
+	defer toolUsageMu.Unlock()
+	app := GetApp()
+	record, err := app.FindFirstRecordByFilter(toolUsageCollection,
+		"user_id = {:user} && channel_id = {:channel} && server = {:server} && tool = {:tool}",
+		dbx.Params{"user": userID, "channel": channelID, "server": server, "tool": tool})
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	if record == nil {
+		collection, err := app.FindCollectionByNameOrId(toolUsageCollection)
+		if err != nil {
+			return err
+		}
+		record = core.NewRecord(collection)
+		record.Set("user_id", userID)
+		record.Set("channel_id", channelID)
+		record.Set("server", server)
+		record.Set("tool", tool)
+	}
+	record.Set("uses", record.GetInt("uses")+1)
+	record.Set("last_used_at", formatTime(time.Now()))
+	return app.Save(record)
+}
+
+// ListToolUses returns the usage counts of userID (in any channel) and of
+// anyone in channelID, used since the given time.
+func ListToolUses(userID, channelID string, since time.Time) ([]*ToolUse, error) {
+	records, err := GetApp().FindRecordsByFilter(toolUsageCollection,
+		"(user_id = {:user} || channel_id = {:channel}) && last_used_at >= {:since}", "-uses", 500, 0,
+		dbx.Params{"user": userID, "channel": channelID, "since": formatTime(since)})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	out := make([]*ToolUse, 0, len(records))
+	for _, r := range records {
+		out = append(out, &ToolUse{
+			UserID:     r.GetString("user_id"),
+			ChannelID:  r.GetString("channel_id"),
+			Server:     r.GetString("server"),
+			Tool:       r.GetString("tool"),
+			Uses:       r.GetInt("uses"),
+			LastUsedAt: parseTime(r.GetString("last_used_at")),
+		})
+	}
+	return out, nil
+}